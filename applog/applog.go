@@ -22,81 +22,265 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"sync"
+	"time"
 
 	"cloud.google.com/go/logging"
-	"go.opencensus.io/trace"
 )
 
 const LOGNAME string = "oc-spannerlab"
 
-var (
-	client    *logging.Client
+// Keys of the fields used across the application, so that the same field
+// can be queried for every action
+const (
+	FIELD_ACTION      = "action"
+	FIELD_ROWS        = "rows"
+	FIELD_LATENCY_MS  = "latency_ms"
+	FIELD_ERROR       = "error"
+	FIELD_ERROR_CLASS = "error_class"
+	FIELD_QUERY       = "query"
+)
+
+// A named value in a structured log entry
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Make a field
+func F(key string, value interface{}) Field {
+	return Field{key, value}
+}
+
+// Writes entries of the enabled levels to a sink, with the trace of the
+// context they are logged in
+type Logger struct {
+	sink Sink
+	// Names the trace of each entry
 	projectId string
+
+	// Guards the variables below
+	mu            sync.RWMutex
+	level         logging.Severity
+	packageLevels map[string]logging.Severity
+	// Share of the unsampled traces whose entries below Error are logged
+	unsampledRate float64
+}
+
+// A logger writing to the sink at the default level with every entry sampled
+func New(sink Sink, projectId string) *Logger {
+	return &Logger{
+		sink:          sink,
+		projectId:     projectId,
+		level:         DEFAULT_LEVEL,
+		packageLevels: map[string]logging.Severity{},
+		unsampledRate: 1,
+	}
+}
+
+// A logger writing to the sink for a --log-sink flag value, see OpenSink
+func Open(spec, projectId string) (*Logger, error) {
+	s, err := OpenSink(spec, projectId)
+	if err != nil {
+		return nil, err
+	}
+	return New(s, projectId), nil
+}
+
+// Close and flush the log sink. Closing a nil logger does nothing.
+func (l *Logger) Close() error {
+	if l == nil || l.sink == nil {
+		return nil
+	}
+	return l.sink.Close()
+}
+
+var (
+	defaultLogger = New(NewStdSink(), "")
+	defaultMu     sync.Mutex
 )
 
-// Close and flush the logging client
+// The logger used by the package functions for contexts without a logger
+func Default() *Logger {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	return defaultLogger
+}
+
+// Set the logger used by the package functions for contexts without a logger
+func SetDefault(l *Logger) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultLogger = l
+}
+
+type contextKey struct{}
+
+// A context carrying the logger, used by the package functions logging in
+// the context and its children
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// The logger carried by the context, or the default logger
+func FromContext(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(contextKey{}).(*Logger); ok && l != nil {
+		return l
+	}
+	return Default()
+}
+
+// Close and flush the default logger
 func Close() {
-	err := client.Close()
+	err := Default().Close()
 	if err != nil {
-		fmt.Printf("Failed to close logging client: %v", err)
+		fmt.Printf("Failed to close log sink: %v", err)
 	}
 }
 
+// Log a debug message with the given context, may include trace and span
+func (l *Logger) Debugf(ctx context.Context, format string,
+	v ...interface{}) {
+	l.printf(ctx, logging.Debug, format, v...)
+}
+
+// Log a message with the given context, may include trace and span
+func (l *Logger) Printf(ctx context.Context, format string,
+	v ...interface{}) {
+	l.printf(ctx, logging.Info, format, v...)
+}
+
+// Log a warning with the given context, may include trace and span
+func (l *Logger) Warningf(ctx context.Context, format string,
+	v ...interface{}) {
+	l.printf(ctx, logging.Warning, format, v...)
+}
+
 // Log an error with the given context, may include trace and span
-func Errorf(ctx context.Context, format string, v ...interface{}) {
-	printf(ctx, logging.Error, format, v...)
+func (l *Logger) Errorf(ctx context.Context, format string,
+	v ...interface{}) {
+	l.printf(ctx, logging.Error, format, v...)
 }
 
-// Log a fatal error with the given context, may include trace and span
-func Fatalf(ctx context.Context, format string, v ...interface{}) {
-	printf(ctx, logging.Critical, format, v...)
+// Log a fatal error with the given context and exit. Fatal errors are logged
+// at every level.
+func (l *Logger) Fatalf(ctx context.Context, format string,
+	v ...interface{}) {
+	l.write(ctx, logging.Critical, fmt.Sprintf(format, v...), nil)
+	l.Close()
 	log.Fatalf(format, v...)
 }
 
-// Initialize the Cloud Logging client
-func Initialize(projId string) {
-	projectId = projId
-	ctx := context.Background()
-	var err error
-	client, err = logging.NewClient(ctx, projId)
-	if err != nil {
-		fmt.Printf("Failed to create logging client: %v", err)
-		return
-	}
-	fmt.Printf("Stackdriver Logging initialized with project id %s, see Cloud " +
-		" Console under GCE VM instance > all instance_id\n", projectId)
+// Log a debug message with fields, may include trace and span
+func (l *Logger) Debug(ctx context.Context, msg string, fields ...Field) {
+	l.log(ctx, logging.Debug, msg, fields)
+}
+
+// Log a message with fields that can be queried in Cloud Logging and the JSON
+// output, may include trace and span
+func (l *Logger) Info(ctx context.Context, msg string, fields ...Field) {
+	l.log(ctx, logging.Info, msg, fields)
+}
+
+// Log a warning with fields, may include trace and span
+func (l *Logger) Warning(ctx context.Context, msg string, fields ...Field) {
+	l.log(ctx, logging.Warning, msg, fields)
+}
+
+// Log an error message with fields, may include trace and span
+func (l *Logger) Error(ctx context.Context, msg string, fields ...Field) {
+	l.log(ctx, logging.Error, msg, fields)
+}
+
+// The package functions log with the logger of the context
+
+// Log a debug message with the given context, may include trace and span
+func Debugf(ctx context.Context, format string, v ...interface{}) {
+	FromContext(ctx).printf(ctx, logging.Debug, format, v...)
 }
 
 // Send to Cloud Logging service including reference to current span
 func Printf(ctx context.Context, format string, v ...interface{}) {
-	printf(ctx, logging.Info, format, v...)
+	FromContext(ctx).printf(ctx, logging.Info, format, v...)
 }
 
-// Send to Cloud Logging service including reference to current span
+// Log a warning with the given context, may include trace and span
+func Warningf(ctx context.Context, format string, v ...interface{}) {
+	FromContext(ctx).printf(ctx, logging.Warning, format, v...)
+}
+
+// Log an error with the given context, may include trace and span
+func Errorf(ctx context.Context, format string, v ...interface{}) {
+	FromContext(ctx).printf(ctx, logging.Error, format, v...)
+}
+
+// Log a fatal error with the given context, may include trace and span. Fatal
+// errors are logged at every level.
+func Fatalf(ctx context.Context, format string, v ...interface{}) {
+	FromContext(ctx).Fatalf(ctx, format, v...)
+}
+
+// Log a debug message with fields, may include trace and span
+func Debug(ctx context.Context, msg string, fields ...Field) {
+	FromContext(ctx).log(ctx, logging.Debug, msg, fields)
+}
+
+// Log a message with fields that can be queried in Cloud Logging and the JSON
+// output, may include trace and span
+func Info(ctx context.Context, msg string, fields ...Field) {
+	FromContext(ctx).log(ctx, logging.Info, msg, fields)
+}
+
+// Log a warning with fields, may include trace and span
+func Warning(ctx context.Context, msg string, fields ...Field) {
+	FromContext(ctx).log(ctx, logging.Warning, msg, fields)
+}
+
+// Log an error message with fields, may include trace and span
+func Error(ctx context.Context, msg string, fields ...Field) {
+	FromContext(ctx).log(ctx, logging.Error, msg, fields)
+}
+
+// Format and log the message if the severity is enabled. Must be called
+// directly from the exported functions, which find the caller's package.
+func (l *Logger) printf(ctx context.Context, severity logging.Severity,
+	format string, v ...interface{}) {
+	if l.enabled(ctx, severity) {
+		l.write(ctx, severity, fmt.Sprintf(format, v...), nil)
+	}
+}
+
+// Log the message with fields if the severity is enabled. Must be called
+// directly from the exported functions, which find the caller's package.
+func (l *Logger) log(ctx context.Context, severity logging.Severity,
+	msg string, fields []Field) {
+	if l.enabled(ctx, severity) {
+		l.write(ctx, severity, msg, fields)
+	}
+}
+
+// Send an entry to the log sink including reference to current span
 // [START spannerlab_trace_correlation]
-func printf(ctx context.Context, severity logging.Severity, format string,
-	v ...interface{}) {
-	span := trace.FromContext(ctx)
-	if client == nil {
-		log.Printf(format, v...)
-	} else if span == nil {
-		lg := client.Logger(LOGNAME)
-		lg.Log(logging.Entry{
-			Severity: severity,
-			Payload:  fmt.Sprintf(format, v...),
-		})
-	} else {
-		sCtx := span.SpanContext()
-		tr := sCtx.TraceID.String()
-		lg := client.Logger(LOGNAME)
-		trace := fmt.Sprintf("projects/%s/traces/%s", projectId, tr)
-		lg.Log(logging.Entry{
-			Severity: severity,
-			Payload:  fmt.Sprintf(format, v...),
-			Trace:    trace,
-			SpanID:   sCtx.SpanID.String(),
-		})
+func (l *Logger) write(ctx context.Context, severity logging.Severity,
+	msg string, fields []Field) {
+	e := Entry{
+		Time:     time.Now(),
+		Severity: severity,
+		Message:  msg,
+	}
+	if len(fields) > 0 {
+		e.Fields = map[string]interface{}{}
+		for _, f := range fields {
+			e.Fields[f.Key] = f.Value
+		}
+	}
+	if sc, ok := SpanContextFromContext(ctx); ok {
+		e.Trace = fmt.Sprintf("projects/%s/traces/%s", l.projectId,
+			sc.TraceID)
+		e.SpanID = sc.SpanID
+		e.TraceSampled = sc.Sampled
 	}
+	l.sink.Write(e)
 }
 
 // [END spannerlab_trace_correlation]
@@ -0,0 +1,163 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package applog
+
+/**
+  Minimum severity of the entries that are logged, for the whole application
+  and for single packages. Entries below the level are dropped before their
+  message is formatted.
+ **/
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+
+	"cloud.google.com/go/logging"
+)
+
+// The severity levels and their names for the --log-level flag
+var LEVELS = map[string]logging.Severity{
+	"debug":    logging.Debug,
+	"info":     logging.Info,
+	"warning":  logging.Warning,
+	"error":    logging.Error,
+	"critical": logging.Critical,
+}
+
+const DEFAULT_LEVEL = logging.Info
+
+// Look up a severity level by name, ignoring case
+func ParseLevel(name string) (logging.Severity, error) {
+	if sev, ok := LEVELS[strings.ToLower(name)]; ok {
+		return sev, nil
+	}
+	return 0, fmt.Errorf("Unknown log level %s, expected one of "+
+		"[debug | info | warning | error | critical]", name)
+}
+
+// Set the levels from a list of a default level and package overrides, like
+// warning,update=debug. Packages are named by the last element of their
+// import path. The default level is unchanged if not given.
+func (l *Logger) SetLevels(spec string) error {
+	def := l.GetLevel()
+	overrides := map[string]logging.Severity{}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		sev, err := ParseLevel(parts[len(parts)-1])
+		if err != nil {
+			return err
+		}
+		if len(parts) == 1 {
+			def = sev
+		} else {
+			overrides[parts[0]] = sev
+		}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.level = def
+	l.packageLevels = overrides
+	return nil
+}
+
+// The default minimum severity
+func (l *Logger) GetLevel() logging.Severity {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.level
+}
+
+// Set the default minimum severity
+func (l *Logger) SetLevel(sev logging.Severity) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.level = sev
+}
+
+// Set the minimum severity of the entries logged from a package
+func (l *Logger) SetPackageLevel(pkg string, sev logging.Severity) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.packageLevels[pkg] = sev
+}
+
+// Set the levels of the default logger, see Logger.SetLevels
+func SetLevels(spec string) error {
+	return Default().SetLevels(spec)
+}
+
+// The default minimum severity of the default logger
+func GetLevel() logging.Severity {
+	return Default().GetLevel()
+}
+
+// Set the default minimum severity of the default logger
+func SetLevel(sev logging.Severity) {
+	Default().SetLevel(sev)
+}
+
+// Set the minimum severity of the entries the default logger logs from a
+// package
+func SetPackageLevel(pkg string, sev logging.Severity) {
+	Default().SetPackageLevel(pkg, sev)
+}
+
+// Whether entries of the severity are logged from the caller of the exported
+// function that calls this through printf or log, in the trace of the
+// context. The caller is only looked up if a package level is set.
+func (l *Logger) enabled(ctx context.Context,
+	severity logging.Severity) bool {
+	return l.levelEnabled(severity) && l.sampled(ctx, severity)
+}
+
+func (l *Logger) levelEnabled(severity logging.Severity) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if len(l.packageLevels) == 0 {
+		return severity >= l.level
+	}
+	if sev, ok := l.packageLevels[callerPackage(5)]; ok {
+		return severity >= sev
+	}
+	return severity >= l.level
+}
+
+// The last element of the import path of the package of the function skip
+// frames up the stack
+func callerPackage(skip int) string {
+	pc, _, _, ok := runtime.Caller(skip)
+	if !ok {
+		return ""
+	}
+	f := runtime.FuncForPC(pc)
+	if f == nil {
+		return ""
+	}
+	// Like github.com/org/repo/update.addAlbum.func1 or main.main
+	name := f.Name()
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	if i := strings.Index(name, "."); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
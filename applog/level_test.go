@@ -0,0 +1,100 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package applog
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/logging"
+)
+
+// Records whether it was formatted
+type formatted struct {
+	called bool
+}
+
+func (f *formatted) String() string {
+	f.called = true
+	return "formatted"
+}
+
+func TestLevels(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := New(NewJSONSink(buf), "")
+	ctx := context.Background()
+
+	if err := l.SetLevels("warning"); err != nil {
+		t.Fatalf("SetLevels error = %v", err)
+	}
+	arg := &formatted{}
+	l.Debugf(ctx, "Debug %v", arg)
+	l.Printf(ctx, "Info %v", arg)
+	l.Info(ctx, "Info")
+	l.Warningf(ctx, "Warning %v", arg)
+	l.Error(ctx, "Error")
+	got := buf.String()
+	if strings.Contains(got, "Debug") || strings.Contains(got, "Info") {
+		t.Errorf("Entries below the level were logged: %s", got)
+	}
+	if !strings.Contains(got, "Warning formatted") ||
+		!strings.Contains(got, `"message":"Error"`) {
+		t.Errorf("Entries at or above the level are missing: %s", got)
+	}
+
+	buf.Reset()
+	arg = &formatted{}
+	l.Debugf(ctx, "Debug %v", arg)
+	if arg.called || buf.Len() != 0 {
+		t.Errorf("Disabled debug message was formatted or logged: %s",
+			buf.String())
+	}
+
+	// Entries from this test are logged from package applog
+	if err := l.SetLevels("error,applog=debug,update=error"); err != nil {
+		t.Fatalf("SetLevels error = %v", err)
+	}
+	if l.GetLevel() != logging.Error {
+		t.Errorf("GetLevel() = %v, want Error", l.GetLevel())
+	}
+	l.Debug(ctx, "Package debug")
+	Debugf(NewContext(ctx, l), "Package function debug")
+	if !strings.Contains(buf.String(), "Package debug") ||
+		!strings.Contains(buf.String(), "Package function debug") {
+		t.Errorf("Package override not applied: %s", buf.String())
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	l := New(NewNopSink(), "")
+	for name, want := range map[string]logging.Severity{
+		"debug": logging.Debug, "Warning": logging.Warning,
+		"ERROR": logging.Error,
+	} {
+		if got, err := ParseLevel(name); err != nil || got != want {
+			t.Errorf("ParseLevel(%q) = %v, %v, want %v", name, got, err, want)
+		}
+	}
+	for _, spec := range []string{"verbose", "update=loud", "info,=x"} {
+		if err := l.SetLevels(spec); err == nil {
+			t.Errorf("SetLevels(%q) succeeded, want error", spec)
+		}
+	}
+	if l.GetLevel() != DEFAULT_LEVEL {
+		t.Errorf("Failed SetLevels changed the level to %v", l.GetLevel())
+	}
+}
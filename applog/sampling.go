@@ -0,0 +1,108 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package applog
+
+/**
+  Sampling of log entries by the sampling decision of their trace. Entries in
+  sampled traces are all logged, so the trace view shows the logs next to the
+  spans, while only a share of the entries in unsampled traces are. Errors
+  are logged in every trace.
+ **/
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+
+	"cloud.google.com/go/logging"
+)
+
+// Values for the --log-sampling flag besides a share between 0 and 1
+const (
+	// Log every entry
+	SAMPLING_ALL = "all"
+	// Log only errors in unsampled traces
+	SAMPLING_ERRORS = "errors"
+)
+
+// Parse a --log-sampling flag value, all, errors or the share of unsampled
+// traces to log, into the share
+func ParseSampling(spec string) (float64, error) {
+	switch spec {
+	case SAMPLING_ALL:
+		return 1, nil
+	case SAMPLING_ERRORS:
+		return 0, nil
+	}
+	r, err := strconv.ParseFloat(spec, 64)
+	if err != nil || r < 0 || r > 1 {
+		return 0, fmt.Errorf("Unknown log sampling %s, expected one of "+
+			"[all | errors | RATE between 0 and 1]", spec)
+	}
+	return r, nil
+}
+
+// The share of the unsampled traces whose entries below Error are logged
+func (l *Logger) GetUnsampledRate() float64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.unsampledRate
+}
+
+// Set the share of the unsampled traces whose entries below Error are
+// logged, 1 to log every entry and 0 to log only errors
+func (l *Logger) SetUnsampledRate(r float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.unsampledRate = r
+}
+
+// The share of the unsampled traces the default logger logs
+func GetUnsampledRate() float64 {
+	return Default().GetUnsampledRate()
+}
+
+// Set the share of the unsampled traces the default logger logs
+func SetUnsampledRate(r float64) {
+	Default().SetUnsampledRate(r)
+}
+
+// Whether an entry of the severity in the trace of the context is logged.
+// Entries outside a span are always logged. The decision for an unsampled
+// trace is made from its trace ID, so a trace has either all of its entries
+// or none.
+func (l *Logger) sampled(ctx context.Context,
+	severity logging.Severity) bool {
+	if severity >= logging.Error {
+		return true
+	}
+	rate := l.GetUnsampledRate()
+	if rate >= 1 {
+		return true
+	}
+	sc, ok := SpanContextFromContext(ctx)
+	if !ok {
+		return true
+	}
+	if sc.Sampled {
+		return true
+	}
+	// The OpenCensus probability sampler uses the last 8 bytes of the trace
+	// ID, the first 8 are used so that the two decisions are independent
+	x, _ := strconv.ParseUint(sc.TraceID[:16], 16, 64)
+	x >>= 1
+	return float64(x) < rate*float64(math.MaxInt64)
+}
@@ -0,0 +1,88 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package applog
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"go.opencensus.io/trace"
+)
+
+// Log an Info and an Error entry in n traces with the sampler, logging the
+// rate of the unsampled traces, and count the entries logged
+func logInTraces(rate float64, n int, sampler trace.Sampler) (infos,
+	errors int) {
+	buf := &bytes.Buffer{}
+	l := New(NewJSONSink(buf), "")
+	l.SetUnsampledRate(rate)
+	for i := 0; i < n; i++ {
+		ctx, span := trace.StartSpan(context.Background(), "test",
+			trace.WithSampler(sampler))
+		l.Printf(ctx, "Info")
+		l.Errorf(ctx, "Error")
+		span.End()
+	}
+	infos = strings.Count(buf.String(), `"severity":"INFO"`)
+	errors = strings.Count(buf.String(), `"severity":"ERROR"`)
+	return infos, errors
+}
+
+func TestSampling(t *testing.T) {
+	const n = 1000
+
+	if infos, errors := logInTraces(0, n, trace.AlwaysSample()); infos != n ||
+		errors != n {
+		t.Errorf("Sampled traces logged %d infos, %d errors, want %d each",
+			infos, errors, n)
+	}
+	if infos, errors := logInTraces(0, n, trace.NeverSample()); infos != 0 ||
+		errors != n {
+		t.Errorf("Unsampled traces with errors only logged %d infos, %d "+
+			"errors, want 0, %d", infos, errors, n)
+	}
+
+	infos, errors := logInTraces(0.2, n, trace.NeverSample())
+	if infos < n/10 || infos > n*3/10 || errors != n {
+		t.Errorf("Unsampled traces at 0.2 logged %d infos, %d errors, want "+
+			"about %d, %d", infos, errors, n/5, n)
+	}
+
+	buf := &bytes.Buffer{}
+	l := New(NewJSONSink(buf), "")
+	l.SetUnsampledRate(0)
+	l.Printf(context.Background(), "Outside a span")
+	if buf.Len() == 0 {
+		t.Errorf("Entry outside a span was dropped")
+	}
+}
+
+func TestParseSampling(t *testing.T) {
+	for spec, want := range map[string]float64{
+		"all": 1, "errors": 0, "0.25": 0.25,
+	} {
+		if got, err := ParseSampling(spec); err != nil || got != want {
+			t.Errorf("ParseSampling(%q) = %v, %v, want %v", spec, got, err,
+				want)
+		}
+	}
+	for _, spec := range []string{"some", "1.5", "-0.1"} {
+		if _, err := ParseSampling(spec); err == nil {
+			t.Errorf("ParseSampling(%q) succeeded, want error", spec)
+		}
+	}
+}
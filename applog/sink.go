@@ -0,0 +1,238 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package applog
+
+/**
+  Destinations for log entries. Cloud Logging correlates the entries with
+  traces in the Cloud Console. JSON lines use the field names of the Cloud
+  Logging structured log format, so the logging agent or any other log
+  pipeline can read them and keep the correlation, and they can be read
+  locally without a GCP project.
+ **/
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// Sink names for the --log-sink flag
+const (
+	SINK_CLOUD = "cloud"
+	SINK_JSON  = "json"
+	SINK_STD   = "std"
+	SINK_NONE  = "none"
+)
+
+// A log entry with the trace and span it was logged in, if any
+type Entry struct {
+	Time     time.Time
+	Severity logging.Severity
+	Message  string
+	// Named values, written as separate fields by the structured sinks
+	Fields map[string]interface{}
+	// Full resource name of the trace, projects/PROJECT/traces/TRACE_ID
+	Trace        string
+	SpanID       string
+	TraceSampled bool
+}
+
+// Destination of log entries
+type Sink interface {
+	Write(e Entry)
+	// Flush the entries written and release the sink
+	Close() error
+}
+
+// Sends entries to Cloud Logging
+type cloudSink struct {
+	client *logging.Client
+	logger *logging.Logger
+}
+
+func NewCloudSink(projectId string) (Sink, error) {
+	client, err := logging.NewClient(context.Background(), projectId)
+	if err != nil {
+		return nil, err
+	}
+	return &cloudSink{client: client, logger: client.Logger(LOGNAME)}, nil
+}
+
+// Entries with fields are sent as a JSON payload with the message in the
+// message field
+func (s *cloudSink) Write(e Entry) {
+	var payload interface{} = e.Message
+	if len(e.Fields) > 0 {
+		m := map[string]interface{}{}
+		for k, v := range e.Fields {
+			m[k] = v
+		}
+		m[JSON_MESSAGE] = e.Message
+		payload = m
+	}
+	s.logger.Log(logging.Entry{
+		Timestamp:    e.Time,
+		Severity:     e.Severity,
+		Payload:      payload,
+		Trace:        e.Trace,
+		SpanID:       e.SpanID,
+		TraceSampled: e.TraceSampled,
+	})
+}
+
+func (s *cloudSink) Close() error {
+	return s.client.Close()
+}
+
+// Writes entries as JSON objects, one per line
+type jsonSink struct {
+	mu sync.Mutex
+	w  io.Writer
+	c  io.Closer
+}
+
+// A JSON lines sink writing to w. Closing the sink does not close w.
+func NewJSONSink(w io.Writer) Sink {
+	return &jsonSink{w: w}
+}
+
+// A JSON lines sink appending to a file
+func NewJSONFileSink(path string) (Sink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonSink{w: f, c: f}, nil
+}
+
+// Names of the fields of an entry in the Cloud Logging structured log format
+const (
+	JSON_TIME     = "time"
+	JSON_SEVERITY = "severity"
+	JSON_MESSAGE  = "message"
+	JSON_TRACE    = "logging.googleapis.com/trace"
+	JSON_SPAN_ID  = "logging.googleapis.com/spanId"
+	// Whether the trace was sampled, so the trace view shows the entry
+	JSON_TRACE_SAMPLED = "logging.googleapis.com/trace_sampled"
+)
+
+// Fields of the entry are written next to the message. They cannot replace
+// the standard fields.
+func (s *jsonSink) Write(e Entry) {
+	m := map[string]interface{}{}
+	for k, v := range e.Fields {
+		m[k] = v
+	}
+	m[JSON_TIME] = e.Time.Format(time.RFC3339Nano)
+	// Cloud Logging recognizes the upper case names, like INFO and WARNING
+	m[JSON_SEVERITY] = strings.ToUpper(e.Severity.String())
+	m[JSON_MESSAGE] = e.Message
+	if e.Trace != "" {
+		m[JSON_TRACE] = e.Trace
+		m[JSON_SPAN_ID] = e.SpanID
+		m[JSON_TRACE_SAMPLED] = e.TraceSampled
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		log.Printf("Failed to encode log entry: %v", err)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.w.Write(append(b, '\n'))
+}
+
+func (s *jsonSink) Close() error {
+	if s.c == nil {
+		return nil
+	}
+	return s.c.Close()
+}
+
+// Prints the message with the standard log package
+type stdSink struct{}
+
+func NewStdSink() Sink {
+	return stdSink{}
+}
+
+// Fields are appended to the message as key=value, sorted by key
+func (stdSink) Write(e Entry) {
+	if len(e.Fields) == 0 {
+		log.Print(e.Message)
+		return
+	}
+	keys := make([]string, 0, len(e.Fields))
+	for k := range e.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(e.Message)
+	for _, k := range keys {
+		fmt.Fprintf(&b, " %s=%v", k, e.Fields[k])
+	}
+	log.Print(b.String())
+}
+
+func (stdSink) Close() error {
+	return nil
+}
+
+// Drops every entry
+type nopSink struct{}
+
+func NewNopSink() Sink {
+	return nopSink{}
+}
+
+func (nopSink) Write(e Entry) {}
+
+func (nopSink) Close() error {
+	return nil
+}
+
+// Create the sink for a --log-sink flag value: cloud, json for stderr,
+// json:PATH for a file, std or none. The JSON lines go to stderr so that they
+// are not mixed with the progress and report output on stdout.
+func OpenSink(spec, projectId string) (Sink, error) {
+	name, path := spec, ""
+	if i := strings.Index(spec, ":"); i >= 0 {
+		name, path = spec[:i], spec[i+1:]
+	}
+	switch {
+	case name == SINK_CLOUD && path == "":
+		return NewCloudSink(projectId)
+	case name == SINK_JSON && path == "":
+		return NewJSONSink(os.Stderr), nil
+	case name == SINK_JSON:
+		return NewJSONFileSink(path)
+	case name == SINK_STD && path == "":
+		return NewStdSink(), nil
+	case name == SINK_NONE && path == "":
+		return NewNopSink(), nil
+	}
+	return nil, fmt.Errorf("Unknown log sink %s, expected one of "+
+		"[cloud | json | json:PATH | std | none]", spec)
+}
@@ -0,0 +1,127 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package applog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"go.opencensus.io/trace"
+)
+
+func TestJSONSink(t *testing.T) {
+	buf := &bytes.Buffer{}
+	ctx := NewContext(context.Background(), New(NewJSONSink(buf),
+		"test-project"))
+
+	// The package functions log with the logger of the context
+	spanCtx, span := trace.StartSpan(ctx, "test",
+		trace.WithSampler(trace.AlwaysSample()))
+	Errorf(spanCtx, "Failed %d times", 3)
+	span.End()
+	Printf(ctx, "No span")
+
+	dec := json.NewDecoder(buf)
+	var got []map[string]interface{}
+	for dec.More() {
+		var m map[string]interface{}
+		if err := dec.Decode(&m); err != nil {
+			t.Fatalf("Failed to decode %q: %v", buf.String(), err)
+		}
+		got = append(got, m)
+	}
+	if len(got) != 2 {
+		t.Fatalf("Got %d entries, want 2", len(got))
+	}
+	sc := span.SpanContext()
+	traceName := "projects/test-project/traces/" + sc.TraceID.String()
+	want := map[string]interface{}{
+		"severity":                             "ERROR",
+		"message":                              "Failed 3 times",
+		"logging.googleapis.com/trace":         traceName,
+		"logging.googleapis.com/spanId":        sc.SpanID.String(),
+		"logging.googleapis.com/trace_sampled": true,
+	}
+	for k, v := range want {
+		if got[0][k] != v {
+			t.Errorf("Entry field %s = %v, want %v", k, got[0][k], v)
+		}
+	}
+	if got[0]["time"] == nil {
+		t.Errorf("Entry has no time")
+	}
+	if _, ok := got[1]["logging.googleapis.com/trace"]; ok {
+		t.Errorf("Entry without a span has a trace: %v", got[1])
+	}
+}
+
+func TestOpenSink(t *testing.T) {
+	for _, spec := range []string{"json", "std", "none"} {
+		s, err := OpenSink(spec, "p")
+		if err != nil {
+			t.Errorf("OpenSink(%q) error = %v", spec, err)
+			continue
+		}
+		s.Close()
+	}
+	for _, spec := range []string{"syslog", "none:x", "cloud:x"} {
+		if _, err := OpenSink(spec, "p"); err == nil {
+			t.Errorf("OpenSink(%q) succeeded, want error", spec)
+		}
+	}
+}
+
+func TestFields(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := New(NewJSONSink(buf), "")
+
+	l.Info(context.Background(), "Query results", F(FIELD_ACTION,
+		"QueryAlbums"), F(FIELD_ROWS, 12), F(JSON_MESSAGE, "ignored"))
+	var got map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("Failed to decode %q: %v", buf.String(), err)
+	}
+	want := map[string]interface{}{
+		JSON_MESSAGE:  "Query results",
+		JSON_SEVERITY: "INFO",
+		FIELD_ACTION:  "QueryAlbums",
+		FIELD_ROWS:    float64(12),
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("Entry field %s = %v, want %v", k, got[k], v)
+		}
+	}
+}
+
+func TestDefaultLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	old := Default()
+	SetDefault(New(NewJSONSink(buf), ""))
+	defer SetDefault(old)
+
+	Printf(context.Background(), "To the default")
+	if !strings.Contains(buf.String(), "To the default") {
+		t.Errorf("Entry without a logger in the context not in the default "+
+			"logger: %q", buf.String())
+	}
+	var l *Logger
+	if err := l.Close(); err != nil {
+		t.Errorf("Close of a nil logger error = %v", err)
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package applog
+
+/**
+  The trace and span an entry is logged in. Besides OpenCensus spans, the span
+  context can come from a W3C traceparent header received from another
+  service, or from any tracing library, like OpenTelemetry, through an
+  extractor, so that the logs stay correlated when part of the stack is
+  traced with another library.
+ **/
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+
+	"go.opencensus.io/trace"
+)
+
+// A trace and span, independent of the tracing library
+type SpanContext struct {
+	// 32 lowercase hex digits
+	TraceID string
+	// 16 lowercase hex digits
+	SpanID  string
+	Sampled bool
+}
+
+// Whether the trace and span ids are well formed and not all zeros
+func (sc SpanContext) IsValid() bool {
+	return validId(sc.TraceID, 16) && validId(sc.SpanID, 8)
+}
+
+func validId(id string, n int) bool {
+	b, err := hex.DecodeString(id)
+	if err != nil || len(b) != n || strings.ToLower(id) != id {
+		return false
+	}
+	for _, x := range b {
+		if x != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// The W3C traceparent header for the span context
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID, sc.SpanID, flags)
+}
+
+// Parse a W3C traceparent header, version-traceid-parentid-flags. Versions
+// above 00 may add fields after the flags.
+func ParseTraceparent(header string) (SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	bad := fmt.Errorf("Bad traceparent %s", header)
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[3]) != 2 {
+		return SpanContext{}, bad
+	}
+	version, err := hex.DecodeString(parts[0])
+	if err != nil || version[0] == 0xff ||
+		(version[0] == 0 && len(parts) != 4) {
+		return SpanContext{}, bad
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return SpanContext{}, bad
+	}
+	sc := SpanContext{
+		TraceID: parts[1],
+		SpanID:  parts[2],
+		Sampled: flags[0]&1 == 1,
+	}
+	if !sc.IsValid() {
+		return SpanContext{}, bad
+	}
+	return sc, nil
+}
+
+// Finds the span context of a context, false if there is none
+type SpanContextExtractor func(ctx context.Context) (SpanContext, bool)
+
+var (
+	extractors []SpanContextExtractor
+	// Guards extractors
+	extractorsMu sync.RWMutex
+)
+
+// Add an extractor for the spans of another tracing library. Extractors are
+// tried after the OpenCensus span and before a traceparent of the context.
+// For OpenTelemetry:
+//
+//	applog.RegisterSpanContextExtractor(
+//		func(ctx context.Context) (applog.SpanContext, bool) {
+//			sc := oteltrace.SpanContextFromContext(ctx)
+//			return applog.SpanContext{
+//				TraceID: sc.TraceID().String(),
+//				SpanID:  sc.SpanID().String(),
+//				Sampled: sc.IsSampled(),
+//			}, sc.IsValid()
+//		})
+func RegisterSpanContextExtractor(f SpanContextExtractor) {
+	extractorsMu.Lock()
+	defer extractorsMu.Unlock()
+	extractors = append(extractors, f)
+}
+
+type spanContextKey struct{}
+
+// A context carrying a span context, like that of a request received from a
+// service traced with another library
+func WithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// A context carrying the span context of a W3C traceparent header
+func WithTraceparent(ctx context.Context, header string) (context.Context,
+	error) {
+	sc, err := ParseTraceparent(header)
+	if err != nil {
+		return ctx, err
+	}
+	return WithSpanContext(ctx, sc), nil
+}
+
+// The span context entries logged in the context belong to: the OpenCensus
+// span, else the span of a registered extractor, else a span context carried
+// with WithSpanContext or WithTraceparent
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	if span := trace.FromContext(ctx); span != nil {
+		sCtx := span.SpanContext()
+		return SpanContext{
+			TraceID: sCtx.TraceID.String(),
+			SpanID:  sCtx.SpanID.String(),
+			Sampled: sCtx.IsSampled(),
+		}, true
+	}
+	extractorsMu.RLock()
+	defer extractorsMu.RUnlock()
+	for _, f := range extractors {
+		if sc, ok := f(ctx); ok && sc.IsValid() {
+			return sc, true
+		}
+	}
+	sc, ok := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc, ok && sc.IsValid()
+}
@@ -0,0 +1,116 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package applog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"go.opencensus.io/trace"
+)
+
+const (
+	TEST_TRACE_ID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	TEST_SPAN_ID  = "00f067aa0ba902b7"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	header := "00-" + TEST_TRACE_ID + "-" + TEST_SPAN_ID + "-01"
+	sc, err := ParseTraceparent(header)
+	if err != nil {
+		t.Fatalf("ParseTraceparent(%q) error = %v", header, err)
+	}
+	want := SpanContext{TEST_TRACE_ID, TEST_SPAN_ID, true}
+	if sc != want {
+		t.Errorf("ParseTraceparent(%q) = %+v, want %+v", header, sc, want)
+	}
+	if sc.Traceparent() != header {
+		t.Errorf("Traceparent() = %q, want %q", sc.Traceparent(), header)
+	}
+	future := "01-" + TEST_TRACE_ID + "-" + TEST_SPAN_ID + "-00-extra"
+	if sc, err := ParseTraceparent(future); err != nil || sc.Sampled {
+		t.Errorf("ParseTraceparent(%q) = %+v, %v, want unsampled", future,
+			sc, err)
+	}
+	for _, bad := range []string{
+		"",
+		"00-" + TEST_TRACE_ID + "-" + TEST_SPAN_ID,
+		"ff-" + TEST_TRACE_ID + "-" + TEST_SPAN_ID + "-01",
+		"00-" + TEST_TRACE_ID + "-" + TEST_SPAN_ID + "-01-extra",
+		"00-00000000000000000000000000000000-" + TEST_SPAN_ID + "-01",
+		"00-" + TEST_TRACE_ID + "-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-" + TEST_SPAN_ID + "-01",
+		"00-" + TEST_TRACE_ID + "-" + TEST_SPAN_ID + "-xx",
+	} {
+		if _, err := ParseTraceparent(bad); err == nil {
+			t.Errorf("ParseTraceparent(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+// Log an entry in the context and decode it
+func logEntry(t *testing.T, ctx context.Context) map[string]interface{} {
+	buf := &bytes.Buffer{}
+	New(NewJSONSink(buf), "p").Printf(ctx, "Entry")
+	var m map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+		t.Fatalf("Failed to decode %q: %v", buf.String(), err)
+	}
+	return m
+}
+
+func TestSpanContextSources(t *testing.T) {
+	ctx, err := WithTraceparent(context.Background(),
+		"00-"+TEST_TRACE_ID+"-"+TEST_SPAN_ID+"-00")
+	if err != nil {
+		t.Fatalf("WithTraceparent error = %v", err)
+	}
+	m := logEntry(t, ctx)
+	if m[JSON_TRACE] != "projects/p/traces/"+TEST_TRACE_ID ||
+		m[JSON_SPAN_ID] != TEST_SPAN_ID || m[JSON_TRACE_SAMPLED] != false {
+		t.Errorf("Entry with a traceparent = %v", m)
+	}
+
+	// An extractor, like one for OpenTelemetry, comes before the traceparent
+	other := SpanContext{"0af7651916cd43dd8448eb211c80319c",
+		"b7ad6b7169203331", true}
+	type otherKey struct{}
+	defer func(saved []SpanContextExtractor) { extractors = saved }(
+		extractors)
+	RegisterSpanContextExtractor(
+		func(ctx context.Context) (SpanContext, bool) {
+			sc, ok := ctx.Value(otherKey{}).(SpanContext)
+			return sc, ok
+		})
+	m = logEntry(t, context.WithValue(ctx, otherKey{}, other))
+	if m[JSON_SPAN_ID] != other.SpanID || m[JSON_TRACE_SAMPLED] != true {
+		t.Errorf("Entry with an extracted span context = %v", m)
+	}
+
+	// The OpenCensus span comes first
+	ocCtx, span := trace.StartSpan(context.WithValue(ctx, otherKey{},
+		other), "test", trace.WithSampler(trace.NeverSample()))
+	defer span.End()
+	m = logEntry(t, ocCtx)
+	if m[JSON_SPAN_ID] != span.SpanContext().SpanID.String() {
+		t.Errorf("Entry in an OpenCensus span = %v", m)
+	}
+
+	if m = logEntry(t, context.Background()); m[JSON_TRACE] != nil {
+		t.Errorf("Entry without a span context has a trace: %v", m)
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright 2019, OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"contrib.go.opencensus.io/exporter/ocagent"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/trace"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/bridge/opencensus"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Value of OTEL_TRACES_EXPORTER and OTEL_METRICS_EXPORTER that sends the
+// spans or the metrics with OTLP. Unset, they go to the OpenCensus agent.
+const exporterOTLP = "otlp"
+
+// Values of OTEL_EXPORTER_OTLP_PROTOCOL, which selects the OTLP transport
+const (
+	protocolGRPC = "grpc"
+	protocolHTTP = "http/protobuf"
+)
+
+// How often the metrics are exported
+const reportingPeriod = 7 * time.Second
+
+// Whether the exporter environment variable selects OTLP
+func otlpSelected(env string) (bool, error) {
+	switch exporter := os.Getenv(env); exporter {
+	case "":
+		return false, nil
+	case exporterOTLP:
+		return true, nil
+	default:
+		return false, fmt.Errorf("unsupported %s %q, expected %q or unset for the OpenCensus agent", env, exporter, exporterOTLP)
+	}
+}
+
+// Register the exporters selected by OTEL_TRACES_EXPORTER and
+// OTEL_METRICS_EXPORTER and return a function that flushes and stops them.
+// The spans and views are recorded with OpenCensus either way, so their names
+// are the same with every exporter.
+func initExporter(ctx context.Context, serviceName string) (func(context.Context) error, error) {
+	tracesOTLP, err := otlpSelected("OTEL_TRACES_EXPORTER")
+	if err != nil {
+		return nil, err
+	}
+	metricsOTLP, err := otlpSelected("OTEL_METRICS_EXPORTER")
+	if err != nil {
+		return nil, err
+	}
+	var flushes []func(context.Context) error
+	if !tracesOTLP || !metricsOTLP {
+		flush, err := initOCAgent(serviceName, !tracesOTLP, !metricsOTLP)
+		if err != nil {
+			return nil, err
+		}
+		flushes = append(flushes, flush)
+	}
+	if tracesOTLP || metricsOTLP {
+		protocol, ok := os.LookupEnv("OTEL_EXPORTER_OTLP_PROTOCOL")
+		if !ok {
+			protocol = protocolGRPC
+		}
+		flush, err := initOTLP(ctx, serviceName, protocol, tracesOTLP, metricsOTLP)
+		if err != nil {
+			// Stop the OpenCensus agent exporter started for the other signal
+			callAll(ctx, flushes)
+			return nil, err
+		}
+		flushes = append(flushes, flush)
+	}
+	return func(ctx context.Context) error {
+		return callAll(ctx, flushes)
+	}, nil
+}
+
+// Call each of the flush or shutdown functions and return the first error
+func callAll(ctx context.Context, fns []func(context.Context) error) error {
+	var err error
+	for _, fn := range fns {
+		if fErr := fn(ctx); err == nil {
+			err = fErr
+		}
+	}
+	return err
+}
+
+// Export the spans, the metrics or both to the OpenCensus agent at
+// OTEL_AGENT_ENDPOINT
+func initOCAgent(serviceName string, traces, metrics bool) (func(context.Context) error, error) {
+	ocAgentAddr, ok := os.LookupEnv("OTEL_AGENT_ENDPOINT")
+	fmt.Printf("Starting metrics load generator, ocAgentAddr: %s\n", ocAgentAddr)
+	if !ok {
+		ocAgentAddr = fmt.Sprintf("%s:%d", ocagent.DefaultAgentHost, ocagent.DefaultAgentPort)
+	}
+	oce, err := ocagent.NewExporter(
+		ocagent.WithAddress(ocAgentAddr),
+		ocagent.WithInsecure(),
+		ocagent.WithServiceName(serviceName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ocagent-exporter: %v", err)
+	}
+	if traces {
+		trace.RegisterExporter(oce)
+	}
+	if metrics {
+		view.RegisterExporter(oce)
+		view.SetReportingPeriod(reportingPeriod)
+	}
+	return func(context.Context) error {
+		if traces {
+			trace.UnregisterExporter(oce)
+		}
+		if metrics {
+			view.UnregisterExporter(oce)
+		}
+		oce.Flush()
+		return oce.Stop()
+	}, nil
+}
+
+// Export the spans, the metrics or both with OTLP over gRPC or HTTP. The
+// OpenCensus bridge hands the spans to the OpenTelemetry SDK and the views are
+// read by the metric reader. The endpoint and its options are read from the
+// standard OTEL_EXPORTER_OTLP_* environment variables, for example
+// OTEL_EXPORTER_OTLP_ENDPOINT=http://otel-agent:4317.
+func initOTLP(ctx context.Context, serviceName, protocol string, traces, metrics bool) (func(context.Context) error, error) {
+	fmt.Printf("Starting metrics load generator, OTLP protocol: %s\n", protocol)
+	if protocol != protocolGRPC && protocol != protocolHTTP {
+		return nil, fmt.Errorf("unknown OTEL_EXPORTER_OTLP_PROTOCOL %q, expected %q or %q", protocol, protocolGRPC, protocolHTTP)
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", serviceName)))
+	if err != nil {
+		return nil, err
+	}
+
+	var shutdowns []func(context.Context) error
+	if traces {
+		var traceExporter sdktrace.SpanExporter
+		if protocol == protocolGRPC {
+			traceExporter, err = otlptracegrpc.New(ctx)
+		} else {
+			traceExporter, err = otlptracehttp.New(ctx)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP trace exporter: %v", err)
+		}
+		tp := sdktrace.NewTracerProvider(
+			sdktrace.WithBatcher(traceExporter),
+			sdktrace.WithResource(res))
+		otel.SetTracerProvider(tp)
+		opencensus.InstallTraceBridge()
+		shutdowns = append(shutdowns, tp.Shutdown)
+	}
+
+	if metrics {
+		var metricExporter sdkmetric.Exporter
+		if protocol == protocolGRPC {
+			metricExporter, err = otlpmetricgrpc.New(ctx)
+		} else {
+			metricExporter, err = otlpmetrichttp.New(ctx)
+		}
+		if err != nil {
+			callAll(ctx, shutdowns)
+			return nil, fmt.Errorf("failed to create OTLP metric exporter: %v", err)
+		}
+		reader := sdkmetric.NewPeriodicReader(metricExporter,
+			sdkmetric.WithInterval(reportingPeriod),
+			sdkmetric.WithProducer(opencensus.NewMetricProducer()))
+		mp := sdkmetric.NewMeterProvider(
+			sdkmetric.WithReader(reader),
+			sdkmetric.WithResource(res))
+		otel.SetMeterProvider(mp)
+		shutdowns = append(shutdowns, mp.Shutdown)
+	}
+
+	return func(ctx context.Context) error {
+		return callAll(ctx, shutdowns)
+	}, nil
+}
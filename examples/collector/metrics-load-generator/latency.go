@@ -0,0 +1,261 @@
+// Copyright 2019, OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Chooses how long each simulated call takes
+type latencyModel interface {
+	next(rng *rand.Rand) time.Duration
+}
+
+// The original model: the range of the latency changes every second
+type mixedLatency struct{}
+
+func (mixedLatency) next(rng *rand.Rand) time.Duration {
+	var sleep int64
+	switch modulus := time.Now().Unix() % 5; modulus {
+	case 0:
+		sleep = rng.Int63n(17001)
+	case 1:
+		sleep = rng.Int63n(8007)
+	case 2:
+		sleep = rng.Int63n(917)
+	case 3:
+		sleep = rng.Int63n(87)
+	case 4:
+		sleep = rng.Int63n(1173)
+	}
+	return time.Duration(sleep) * time.Millisecond
+}
+
+type fixedLatency struct {
+	d time.Duration
+}
+
+func (f fixedLatency) next(*rand.Rand) time.Duration {
+	return f.d
+}
+
+type uniformLatency struct {
+	min, max time.Duration
+}
+
+func (u uniformLatency) next(rng *rand.Rand) time.Duration {
+	return u.min + time.Duration(rng.Int63n(int64(u.max-u.min)+1))
+}
+
+// Normal, with negative values cut to zero
+type normalLatency struct {
+	mean, stddev time.Duration
+}
+
+func (n normalLatency) next(rng *rand.Rand) time.Duration {
+	d := time.Duration(rng.NormFloat64()*float64(n.stddev)) + n.mean
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// Log-normal: the logarithm of the latency is normal, giving the long tail
+// of most real services. Sigma is the standard deviation of the logarithm.
+type logNormalLatency struct {
+	median time.Duration
+	sigma  float64
+}
+
+func (l logNormalLatency) next(rng *rand.Rand) time.Duration {
+	return time.Duration(float64(l.median) * math.Exp(l.sigma*rng.NormFloat64()))
+}
+
+// A share of the calls take the slow path, like cache misses. Both modes are
+// log-normal with bimodalSigma.
+type bimodalLatency struct {
+	fast, slow logNormalLatency
+	slowShare  float64
+}
+
+const bimodalSigma = 0.2
+
+func (b bimodalLatency) next(rng *rand.Rand) time.Duration {
+	if rng.Float64() < b.slowShare {
+		return b.slow.next(rng)
+	}
+	return b.fast.next(rng)
+}
+
+// Replays recorded latencies in order, starting again at the end
+type replayLatency struct {
+	mu        sync.Mutex
+	latencies []time.Duration
+	pos       int
+}
+
+func (r *replayLatency) next(*rand.Rand) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d := r.latencies[r.pos]
+	r.pos = (r.pos + 1) % len(r.latencies)
+	return d
+}
+
+// Read latencies, one per line, as durations like 12.5ms or as numbers of
+// milliseconds. Blank lines and lines starting with # are skipped.
+func readLatencies(path string) ([]time.Duration, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var latencies []time.Duration
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		d, err := parseLatency(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		latencies = append(latencies, d)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(latencies) == 0 {
+		return nil, fmt.Errorf("%s has no latencies", path)
+	}
+	return latencies, nil
+}
+
+// A duration like 250ms, or a number of milliseconds
+func parseLatency(s string) (time.Duration, error) {
+	if ms, err := strconv.ParseFloat(s, 64); err == nil {
+		if ms < 0 {
+			return 0, fmt.Errorf("negative latency %q", s)
+		}
+		return time.Duration(ms * float64(time.Millisecond)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("bad latency %q", s)
+	}
+	return d, nil
+}
+
+// The parameters of each latency model, in order
+var latencyParams = map[string][]string{
+	"mixed":     nil,
+	"fixed":     {"D"},
+	"uniform":   {"MIN", "MAX"},
+	"normal":    {"MEAN", "STDDEV"},
+	"lognormal": {"MEDIAN", "SIGMA"},
+	"bimodal":   {"FAST", "SLOW", "SHARE"},
+}
+
+// Parse a latency model:
+//
+//	mixed                     the original model
+//	fixed:D                   always D
+//	uniform:MIN:MAX           uniform between MIN and MAX
+//	normal:MEAN:STDDEV        normal, cut at zero, STDDEV above 0
+//	lognormal:MEDIAN:SIGMA    log-normal, SIGMA of the logarithm above 0
+//	bimodal:FAST:SLOW:SHARE   SHARE of the calls, between 0 and 1, around
+//	                          SLOW, the rest around FAST
+//	replay:FILE               the latencies in FILE, in order
+//
+// Latencies are durations like 250ms or numbers of milliseconds.
+func parseLatencyModel(spec string) (latencyModel, error) {
+	parts := strings.Split(spec, ":")
+	name, args := parts[0], parts[1:]
+	if name == "replay" {
+		if len(args) == 0 {
+			return nil, fmt.Errorf("latency model %q needs a file", spec)
+		}
+		latencies, err := readLatencies(strings.Join(args, ":"))
+		if err != nil {
+			return nil, err
+		}
+		return &replayLatency{latencies: latencies}, nil
+	}
+	params, ok := latencyParams[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown latency model %q, expected one of mixed, fixed, uniform, normal, lognormal, bimodal or replay", spec)
+	}
+	if len(args) != len(params) {
+		return nil, fmt.Errorf("latency model %q needs %d parameters", spec, len(params))
+	}
+	// Check every parameter before building the model
+	d := map[string]time.Duration{}
+	f := map[string]float64{}
+	for i, param := range params {
+		a := args[i]
+		switch param {
+		case "SIGMA", "SHARE":
+			x, err := strconv.ParseFloat(a, 64)
+			if err != nil {
+				return nil, fmt.Errorf("latency model %q: %s %q is not a number", spec, param, a)
+			}
+			if param == "SIGMA" && x <= 0 {
+				return nil, fmt.Errorf("latency model %q: SIGMA must be above 0", spec)
+			}
+			if param == "SHARE" && (x < 0 || x > 1) {
+				return nil, fmt.Errorf("latency model %q: SHARE must be between 0 and 1", spec)
+			}
+			f[param] = x
+		default:
+			x, err := parseLatency(a)
+			if err != nil {
+				return nil, fmt.Errorf("latency model %q: %s: %v", spec, param, err)
+			}
+			if param == "STDDEV" && x <= 0 {
+				return nil, fmt.Errorf("latency model %q: STDDEV must be above 0", spec)
+			}
+			if param == "MAX" && x < d["MIN"] {
+				return nil, fmt.Errorf("latency model %q has MAX below MIN", spec)
+			}
+			d[param] = x
+		}
+	}
+	switch name {
+	case "mixed":
+		return mixedLatency{}, nil
+	case "fixed":
+		return fixedLatency{d["D"]}, nil
+	case "uniform":
+		return uniformLatency{d["MIN"], d["MAX"]}, nil
+	case "normal":
+		return normalLatency{d["MEAN"], d["STDDEV"]}, nil
+	case "lognormal":
+		return logNormalLatency{d["MEDIAN"], f["SIGMA"]}, nil
+	}
+	return bimodalLatency{
+		fast:      logNormalLatency{d["FAST"], bimodalSigma},
+		slow:      logNormalLatency{d["SLOW"], bimodalSigma},
+		slowShare: f["SHARE"],
+	}, nil
+}
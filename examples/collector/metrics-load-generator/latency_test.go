@@ -0,0 +1,155 @@
+// Copyright 2019, OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLatency(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"250ms", 250 * time.Millisecond, false},
+		{"1.5s", 1500 * time.Millisecond, false},
+		{"12.5", 12500 * time.Microsecond, false},
+		{"0", 0, false},
+		{"-3", 0, true},
+		{"-10ms", 0, true},
+		{"soon", 0, true},
+	}
+	for _, tc := range tests {
+		got, err := parseLatency(tc.in)
+		if (err != nil) != tc.wantErr || got != tc.want {
+			t.Errorf("parseLatency(%q) = %v, %v, want %v, error %t", tc.in, got, err, tc.want, tc.wantErr)
+		}
+	}
+}
+
+func TestParseLatencyModel(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	replay := write("replay.txt", "# recorded\n10ms\n\n20\n")
+	colons := write("at 12:30:00.txt", "5ms\n")
+	empty := write("empty.txt", "# nothing recorded\n\n")
+	bad := write("bad.txt", "10ms\nslow\n")
+
+	tests := []struct {
+		name    string
+		spec    string
+		wantErr bool
+		// The first latencies drawn, if the model is deterministic
+		want []time.Duration
+	}{
+		{"mixed", "mixed", false, nil},
+		{"fixed", "fixed:250ms", false, []time.Duration{250 * time.Millisecond, 250 * time.Millisecond}},
+		{"fixed milliseconds", "fixed:40", false, []time.Duration{40 * time.Millisecond}},
+		{"uniform", "uniform:10ms:20ms", false, nil},
+		{"uniform equal bounds", "uniform:10ms:10ms", false, []time.Duration{10 * time.Millisecond}},
+		{"uniform max below min", "uniform:20ms:10ms", true, nil},
+		{"normal", "normal:100ms:10ms", false, nil},
+		{"normal zero stddev", "normal:100ms:0", true, nil},
+		{"lognormal", "lognormal:80ms:0.6", false, nil},
+		{"lognormal zero sigma", "lognormal:80ms:0", true, nil},
+		{"lognormal negative sigma", "lognormal:80ms:-1", true, nil},
+		{"lognormal sigma not a number", "lognormal:80ms:wide", true, nil},
+		{"bimodal", "bimodal:10ms:500ms:0.1", false, nil},
+		{"bimodal share above 1", "bimodal:10ms:500ms:1.5", true, nil},
+		{"bimodal negative share", "bimodal:10ms:500ms:-0.1", true, nil},
+		{"bimodal share not a number", "bimodal:10ms:500ms:often", true, nil},
+		{"negative latency", "fixed:-5ms", true, nil},
+		{"negative milliseconds", "normal:-5:1", true, nil},
+		{"too few parameters", "uniform:10ms", true, nil},
+		{"too many parameters", "fixed:1ms:2ms", true, nil},
+		{"unknown model", "pareto:1ms", true, nil},
+		{"replay", "replay:" + replay, false, []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 10 * time.Millisecond}},
+		{"replay path with colons", "replay:" + colons, false, []time.Duration{5 * time.Millisecond, 5 * time.Millisecond}},
+		{"replay empty file", "replay:" + empty, true, nil},
+		{"replay bad line", "replay:" + bad, true, nil},
+		{"replay missing file", "replay:" + filepath.Join(dir, "missing.txt"), true, nil},
+		{"replay without file", "replay", true, nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			model, err := parseLatencyModel(tc.spec)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("parseLatencyModel(%q) = %v, want error", tc.spec, model)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseLatencyModel(%q): %v", tc.spec, err)
+			}
+			rng := rand.New(rand.NewSource(1))
+			for i, want := range tc.want {
+				if got := model.next(rng); got != want {
+					t.Errorf("latency %d of %q = %v, want %v", i, tc.spec, got, want)
+				}
+			}
+			for i := 0; i < 100; i++ {
+				if d := model.next(rng); d < 0 {
+					t.Fatalf("%q drew a negative latency %v", tc.spec, d)
+				}
+			}
+		})
+	}
+}
+
+// Each error names the parameter that is wrong
+func TestParseLatencyModelNamesParameter(t *testing.T) {
+	tests := []struct {
+		spec, param string
+	}{
+		{"normal:100ms:0", "STDDEV"},
+		{"lognormal:80ms:0", "SIGMA"},
+		{"bimodal:10ms:500ms:2", "SHARE"},
+		{"bimodal:fast:500ms:0.1", "FAST"},
+		{"bimodal:10ms:slow:0.1", "SLOW"},
+	}
+	for _, tc := range tests {
+		_, err := parseLatencyModel(tc.spec)
+		if err == nil || !strings.Contains(err.Error(), tc.param) {
+			t.Errorf("parseLatencyModel(%q) error = %v, want it to name %s", tc.spec, err, tc.param)
+		}
+	}
+}
+
+// The latencies drawn stay within the bounds of the model
+func TestUniformLatencyBounds(t *testing.T) {
+	model, err := parseLatencyModel("uniform:10ms:20ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		if d := model.next(rng); d < 10*time.Millisecond || d > 20*time.Millisecond {
+			t.Fatalf("uniform:10ms:20ms drew %v", d)
+		}
+	}
+}
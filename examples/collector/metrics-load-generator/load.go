@@ -0,0 +1,152 @@
+// Copyright 2019, OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+	"go.opencensus.io/trace"
+)
+
+// The tags and measures the simulated calls are recorded with
+type instruments struct {
+	keyClient, keyMethod       tag.Key
+	methodValues, clientValues []string
+	mLatencyMs                 *stats.Float64Measure
+	mLineLengths               *stats.Int64Measure
+}
+
+// What a worker did, merged into the final summary
+type workerStats struct {
+	calls        int64
+	lines        int64
+	totalLatency time.Duration
+	minLatency   time.Duration
+	maxLatency   time.Duration
+}
+
+func (s *workerStats) add(o workerStats) {
+	if o.calls == 0 {
+		return
+	}
+	if s.calls == 0 || o.minLatency < s.minLatency {
+		s.minLatency = o.minLatency
+	}
+	if o.maxLatency > s.maxLatency {
+		s.maxLatency = o.maxLatency
+	}
+	s.calls += o.calls
+	s.lines += o.lines
+	s.totalLatency += o.totalLatency
+}
+
+func (s *workerStats) record(latency time.Duration, lines int) {
+	if s.calls == 0 || latency < s.minLatency {
+		s.minLatency = latency
+	}
+	if latency > s.maxLatency {
+		s.maxLatency = latency
+	}
+	s.calls++
+	s.lines += int64(lines)
+	s.totalLatency += latency
+}
+
+// Make simulated calls until the context is done. With a ticker each call
+// waits for a tick, which the workers share, else the next call starts when
+// the last ends. A call cut short by the end of the run is not recorded: its
+// span is never ended, so it is not exported either.
+func worker(ctx context.Context, ticks <-chan time.Time, model latencyModel, in instruments, seed int64, verbose bool) workerStats {
+	var ws workerStats
+	rng := rand.New(rand.NewSource(seed))
+	for {
+		if ticks != nil {
+			select {
+			case <-ctx.Done():
+				return ws
+			case <-ticks:
+			}
+		} else if ctx.Err() != nil {
+			return ws
+		}
+		tagCtx, _ := tag.New(context.Background(),
+			tag.Insert(in.keyMethod, in.methodValues[rng.Intn(len(in.methodValues))]),
+			tag.Insert(in.keyClient, in.clientValues[rng.Intn(len(in.clientValues))]))
+		startTime := time.Now()
+		_, span := trace.StartSpan(context.Background(), "Foo")
+		timer := time.NewTimer(model.next(rng))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ws
+		case <-timer.C:
+		}
+
+		span.End()
+		latency := time.Since(startTime)
+		latencyMs := float64(latency) / 1e6
+		nr := int(rng.Int31n(7))
+		for i := 0; i < nr; i++ {
+			randLineLength := rng.Int63n(999)
+			stats.Record(tagCtx, in.mLineLengths.M(randLineLength))
+			if verbose {
+				fmt.Printf("#%d: LineLength: %dBy\n", i, randLineLength)
+			}
+		}
+		stats.Record(tagCtx, in.mLatencyMs.M(latencyMs))
+		if verbose {
+			fmt.Printf("Latency: %.3fms\n", latencyMs)
+		}
+		ws.record(latency, nr)
+	}
+}
+
+// Run the workers until the context is done and merge what they did. The
+// seeds of the workers are consecutive from seed.
+func runWorkers(ctx context.Context, workers int, ticks <-chan time.Time, model latencyModel, in instruments, seed int64, verbose bool) workerStats {
+	results := make(chan workerStats, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			results <- worker(ctx, ticks, model, in, seed, verbose)
+		}(seed + int64(i))
+	}
+	wg.Wait()
+	close(results)
+	var total workerStats
+	for ws := range results {
+		total.add(ws)
+	}
+	return total
+}
+
+func printSummary(s workerStats, elapsed time.Duration, workers int, seed int64) {
+	fmt.Printf("Summary: %d calls by %d workers in %v, %.1f calls/s, %d lines, seed %d\n",
+		s.calls, workers, elapsed.Round(time.Millisecond), float64(s.calls)/elapsed.Seconds(), s.lines, seed)
+	if s.calls > 0 {
+		fmt.Printf("Latency: min %v, mean %v, max %v\n",
+			s.minLatency.Round(time.Microsecond),
+			(s.totalLatency / time.Duration(s.calls)).Round(time.Microsecond),
+			s.maxLatency.Round(time.Microsecond))
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright 2019, OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+	"go.opencensus.io/trace"
+)
+
+func TestWorkerStats(t *testing.T) {
+	ms := time.Millisecond
+	tests := []struct {
+		name      string
+		latencies [][]time.Duration
+		want      workerStats
+	}{
+		{"no calls", nil, workerStats{}},
+		{"one worker", [][]time.Duration{{30 * ms, 10 * ms, 20 * ms}}, workerStats{calls: 3, lines: 3, totalLatency: 60 * ms, minLatency: 10 * ms, maxLatency: 30 * ms}},
+		{"idle worker", [][]time.Duration{{}, {5 * ms}}, workerStats{calls: 1, lines: 1, totalLatency: 5 * ms, minLatency: 5 * ms, maxLatency: 5 * ms}},
+		{"min and max from different workers", [][]time.Duration{{20 * ms, 40 * ms}, {8 * ms, 30 * ms}}, workerStats{calls: 4, lines: 4, totalLatency: 98 * ms, minLatency: 8 * ms, maxLatency: 40 * ms}},
+	}
+	for _, tc := range tests {
+		var total workerStats
+		for _, latencies := range tc.latencies {
+			var ws workerStats
+			for _, l := range latencies {
+				ws.record(l, 1)
+			}
+			total.add(ws)
+		}
+		if total != tc.want {
+			t.Errorf("%s: stats = %+v, want %+v", tc.name, total, tc.want)
+		}
+	}
+}
+
+// Records the spans ended
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans int
+}
+
+func (r *spanRecorder) ExportSpan(*trace.SpanData) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans++
+}
+
+func (r *spanRecorder) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.spans
+}
+
+func testInstruments(t *testing.T) instruments {
+	keyClient, err := tag.NewKey("client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyMethod, err := tag.NewKey("method")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return instruments{
+		keyClient:    keyClient,
+		keyMethod:    keyMethod,
+		methodValues: tagValues("repl", 2),
+		clientValues: tagValues("cli", 1),
+		mLatencyMs:   stats.Float64("test/latency", "The latency in milliseconds", "ms"),
+		mLineLengths: stats.Int64("test/line_lengths", "The length of each line", "By"),
+	}
+}
+
+// The end of the run stops the calls in flight without recording them or
+// exporting their spans, and only the calls that completed are counted
+func TestRunWorkersShutdown(t *testing.T) {
+	trace.ApplyConfig(trace.Config{DefaultSampler: trace.AlwaysSample()})
+	rec := &spanRecorder{}
+	trace.RegisterExporter(rec)
+	defer trace.UnregisterExporter(rec)
+	in := testInstruments(t)
+
+	tests := []struct {
+		name    string
+		latency string
+		ticks   bool
+		// Whether any call completes before the end of the run
+		completes bool
+	}{
+		{"calls longer than the run", "fixed:1h", false, false},
+		{"short calls", "fixed:1ms", false, true},
+		{"short calls at a rate", "fixed:1ms", true, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			model, err := parseLatencyModel(tc.latency)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ticks <-chan time.Time
+			if tc.ticks {
+				ticker := time.NewTicker(5 * time.Millisecond)
+				defer ticker.Stop()
+				ticks = ticker.C
+			}
+			spansBefore := rec.count()
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			start := time.Now()
+			total := runWorkers(ctx, 3, ticks, model, in, 1, false)
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("Workers stopped %v after the start of a 100ms run", elapsed)
+			}
+			if (total.calls > 0) != tc.completes {
+				t.Errorf("%d calls completed, want some: %t", total.calls, tc.completes)
+			}
+			if spans := rec.count() - spansBefore; int64(spans) != total.calls {
+				t.Errorf("%d spans exported for %d completed calls", spans, total.calls)
+			}
+		})
+	}
+}
+
+// Records the latencies drawn by a model
+type recordingLatency struct {
+	model latencyModel
+	mu    sync.Mutex
+	draws []time.Duration
+}
+
+func (r *recordingLatency) next(rng *rand.Rand) time.Duration {
+	d := r.model.next(rng)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.draws = append(r.draws, d)
+	return d
+}
+
+// The latencies a worker with the seed draws for five calls
+func drawsWithSeed(in instruments, seed int64) []time.Duration {
+	rec := &recordingLatency{model: uniformLatency{0, time.Millisecond}}
+	ticks := make(chan time.Time)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan workerStats)
+	go func() { done <- worker(ctx, ticks, rec, in, seed, false) }()
+	for i := 0; i < 5; i++ {
+		ticks <- time.Now()
+	}
+	cancel()
+	<-done
+	return rec.draws
+}
+
+// A worker started from the same seed draws the same latencies
+func TestWorkerSeed(t *testing.T) {
+	in := testInstruments(t)
+	first := drawsWithSeed(in, 42)
+	if len(first) != 5 {
+		t.Fatalf("%d latencies drawn for 5 calls", len(first))
+	}
+	replayed := drawsWithSeed(in, 42)
+	other := drawsWithSeed(in, 43)
+	same := true
+	for i := range first {
+		if replayed[i] != first[i] {
+			t.Errorf("Latency %d with seed 42 = %v, replayed %v", i, first[i], replayed[i])
+		}
+		same = same && other[i] == first[i]
+	}
+	if same {
+		t.Errorf("Seeds 42 and 43 drew the same latencies %v", first)
+	}
+}
@@ -12,42 +12,57 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-// Sample contains a program that exports to the OpenCensus service.
+// Sample contains a program that exports to the OpenCensus service or to an
+// OTLP receiver.
 package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
-	"math/rand"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
-	"contrib.go.opencensus.io/exporter/ocagent"
 	"go.opencensus.io/stats"
 	"go.opencensus.io/stats/view"
 	"go.opencensus.io/tag"
 	"go.opencensus.io/trace"
 )
 
+// The highest --rate, one call started per nanosecond
+const maxRate = float64(time.Second)
+
 func main() {
-	ocAgentAddr, ok := os.LookupEnv("OTEL_AGENT_ENDPOINT")
-	fmt.Printf("Starting metrics load generator, ocAgentAddr: %s\n", ocAgentAddr)
-	if !ok {
-		ocAgentAddr = ocagent.DefaultAgentHost + ":" + string(ocagent.DefaultAgentPort)
+	latency := flag.String("latency", "mixed", "Latency model of the simulated calls, one of mixed, fixed:D, uniform:MIN:MAX, normal:MEAN:STDDEV, lognormal:MEDIAN:SIGMA, bimodal:FAST:SLOW:SHARE or replay:FILE")
+	rate := flag.Float64("rate", 0, "Calls started per second, 0 to start each call when the last ends")
+	methods := flag.Int("methods", 1, "Number of values of the method tag")
+	clients := flag.Int("clients", 1, "Number of values of the client tag")
+	workers := flag.Int("workers", 1, "Number of calls in flight at once")
+	duration := flag.Duration("duration", 0, "How long to run, 0 to run until SIGTERM or SIGINT")
+	verbose := flag.Bool("verbose", false, "Print the latency and line lengths of each call")
+	seed := flag.Int64("seed", 0, "Seed of the latencies and tags drawn by the workers, 0 for a random seed")
+	flag.Parse()
+	model, err := parseLatencyModel(*latency)
+	if err != nil {
+		log.Fatalf("Bad --latency: %v", err)
+	}
+	if *rate < 0 || *duration < 0 || *methods < 1 || *clients < 1 || *workers < 1 {
+		log.Fatalf("--rate and --duration must not be negative and --methods, --clients and --workers must be at least 1")
+	}
+	// The ticker interval must be at least 1ns
+	if *rate > maxRate {
+		log.Fatalf("--rate must be at most %g calls per second", maxRate)
 	}
-	oce, err := ocagent.NewExporter(
-		ocagent.WithAddress(ocAgentAddr),
-		ocagent.WithInsecure(),
-		ocagent.WithServiceName(fmt.Sprintf("example-go-%d", os.Getpid())))
+
+	flush, err := initExporter(context.Background(), fmt.Sprintf("example-go-%d", os.Getpid()))
 	if err != nil {
-		log.Fatalf("Failed to create ocagent-exporter: %v", err)
+		log.Fatalf("Failed to create exporter: %v", err)
 	}
-	trace.RegisterExporter(oce)
-	view.RegisterExporter(oce)
 
 	// Some configurations to get observability signals out.
-	view.SetReportingPeriod(7 * time.Second)
 	trace.ApplyConfig(trace.Config{
 		DefaultSampler: trace.AlwaysSample(),
 	})
@@ -94,36 +109,67 @@ func main() {
 		log.Fatalf("Failed to register views for metrics: %v", err)
 	}
 
-	ctx, _ := tag.New(context.Background(), tag.Insert(keyMethod, "repl"), tag.Insert(keyClient, "cli"))
-	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
-	for {
-		startTime := time.Now()
-		_, span := trace.StartSpan(context.Background(), "Foo")
-		var sleep int64
-		switch modulus := time.Now().Unix() % 5; modulus {
-		case 0:
-			sleep = rng.Int63n(17001)
-		case 1:
-			sleep = rng.Int63n(8007)
-		case 2:
-			sleep = rng.Int63n(917)
-		case 3:
-			sleep = rng.Int63n(87)
-		case 4:
-			sleep = rng.Int63n(1173)
+	// Values of the method and client tags, repl and cli as before when there
+	// is only one of each
+	in := instruments{
+		keyClient:    keyClient,
+		keyMethod:    keyMethod,
+		methodValues: tagValues("repl", *methods),
+		clientValues: tagValues("cli", *clients),
+		mLatencyMs:   mLatencyMs,
+		mLineLengths: mLineLengths,
+	}
+
+	// Run until SIGTERM, SIGINT or the end of the duration
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if *duration > 0 {
+		ctx, cancel = context.WithTimeout(ctx, *duration)
+		defer cancel()
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		select {
+		case sig := <-sigs:
+			fmt.Printf("Received %v, stopping\n", sig)
+			cancel()
+		case <-ctx.Done():
 		}
+	}()
 
-		time.Sleep(time.Duration(sleep) * time.Millisecond)
+	// The workers share the ticks, so the rate is the total of all workers
+	var ticks <-chan time.Time
+	if *rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / *rate))
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+	start := time.Now()
+	if *seed == 0 {
+		*seed = start.UnixNano()
+	}
+	fmt.Printf("Seed %d, replay with --seed=%d\n", *seed, *seed)
+	total := runWorkers(ctx, *workers, ticks, model, in, *seed, *verbose)
+	elapsed := time.Since(start)
 
-		span.End()
-		latencyMs := float64(time.Since(startTime)) / 1e6
-		nr := int(rng.Int31n(7))
-		for i := 0; i < nr; i++ {
-			randLineLength := rng.Int63n(999)
-			stats.Record(ctx, mLineLengths.M(randLineLength))
-			fmt.Printf("#%d: LineLength: %dBy\n", i, randLineLength)
-		}
-		stats.Record(ctx, mLatencyMs.M(latencyMs))
-		fmt.Printf("Latency: %.3fms\n", latencyMs)
+	// Send what is left before exiting
+	flushCtx, flushCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer flushCancel()
+	if err := flush(flushCtx); err != nil {
+		fmt.Printf("Failed to flush exporter: %v\n", err)
+	}
+	printSummary(total, elapsed, *workers, *seed)
+}
+
+// n values of a tag: the name alone if n is 1, else the name with a number
+func tagValues(name string, n int) []string {
+	if n == 1 {
+		return []string{name}
+	}
+	values := make([]string, n)
+	for i := range values {
+		values[i] = fmt.Sprintf("%s-%d", name, i)
 	}
+	return values
 }
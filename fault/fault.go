@@ -0,0 +1,274 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Fault injection on the gRPC connection of the Spanner client, to show in
+// traces how transaction retries and tail latency react to backend trouble
+// without a real outage. Faults are given as a list of rules like
+//
+//	Commit:aborted@0.2,ExecuteStreamingSql:slow=20ms@0.5,*:delay=100ms@0.05
+//
+// Each rule names an RPC method, or * for all of them, a fault and the rate
+// at which it is injected.
+package fault
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opencensus.io/trace"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/GoogleCloudPlatform/opencensus-spanner-demo/random"
+)
+
+// Kinds of fault
+const (
+	FAULT_ABORTED           = "aborted"
+	FAULT_UNAVAILABLE       = "unavailable"
+	FAULT_DEADLINE_EXCEEDED = "deadline"
+	// Wait before sending the request
+	FAULT_DELAY = "delay"
+	// Wait before receiving each message of a streaming response
+	FAULT_SLOW_STREAM = "slow"
+)
+
+// Match all methods
+const ANY_METHOD = "*"
+
+var errorCodes = map[string]codes.Code{
+	FAULT_ABORTED:           codes.Aborted,
+	FAULT_UNAVAILABLE:       codes.Unavailable,
+	FAULT_DEADLINE_EXCEEDED: codes.DeadlineExceeded,
+}
+
+// A fault injected into calls of a method at a rate between 0 and 1
+type Rule struct {
+	Method string
+	Kind   string
+	Delay  time.Duration
+	Rate   float64
+}
+
+func (r Rule) String() string {
+	if r.Delay > 0 {
+		return fmt.Sprintf("%s:%s=%v@%g", r.Method, r.Kind, r.Delay, r.Rate)
+	}
+	return fmt.Sprintf("%s:%s@%g", r.Method, r.Kind, r.Rate)
+}
+
+// Whether the rule applies to the full gRPC method name, like
+// /google.spanner.v1.Spanner/Commit
+func (r Rule) matches(fullMethod string) bool {
+	if r.Method == ANY_METHOD {
+		return true
+	}
+	return fullMethod[strings.LastIndex(fullMethod, "/")+1:] == r.Method
+}
+
+type Injector struct {
+	rules []Rule
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// Create an injector for the rules. Its choices have their own sequence,
+// started from the seed of the run, so that injecting faults does not change
+// the actions and data of the run.
+func New(rules ...Rule) *Injector {
+	return &Injector{
+		rules: rules,
+		rng:   rand.New(rand.NewSource(random.GetSeed())),
+	}
+}
+
+// Parse a list of rules of the form METHOD:FAULT[=DURATION]@RATE. The delay
+// and slow faults need a duration. An empty list gives an injector that
+// does nothing.
+func Parse(s string) (*Injector, error) {
+	var rules []Rule
+	if strings.TrimSpace(s) == "" {
+		return New(), nil
+	}
+	for _, entry := range strings.Split(s, ",") {
+		rule, err := parseRule(strings.TrimSpace(entry))
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return New(rules...), nil
+}
+
+func parseRule(s string) (Rule, error) {
+	var rule Rule
+	colon := strings.Index(s, ":")
+	at := strings.LastIndex(s, "@")
+	if colon <= 0 || at < colon {
+		return rule, fmt.Errorf(
+			"Fault %s is not of the form METHOD:FAULT[=DURATION]@RATE", s)
+	}
+	rule.Method = s[:colon]
+	rate, err := strconv.ParseFloat(s[at+1:], 64)
+	if err != nil || rate < 0 || rate > 1 {
+		return rule, fmt.Errorf("Fault %s rate must be between 0 and 1", s)
+	}
+	rule.Rate = rate
+	kind := s[colon+1 : at]
+	if eq := strings.Index(kind, "="); eq >= 0 {
+		delay, err := time.ParseDuration(kind[eq+1:])
+		if err != nil {
+			return rule, fmt.Errorf("Fault %s: %v", s, err)
+		}
+		rule.Delay = delay
+		kind = kind[:eq]
+	}
+	rule.Kind = kind
+	switch kind {
+	case FAULT_ABORTED, FAULT_UNAVAILABLE, FAULT_DEADLINE_EXCEEDED:
+		if rule.Delay != 0 {
+			return rule, fmt.Errorf("Fault %s does not take a duration", s)
+		}
+	case FAULT_DELAY, FAULT_SLOW_STREAM:
+		if rule.Delay <= 0 {
+			return rule, fmt.Errorf("Fault %s needs a duration", s)
+		}
+	default:
+		return rule, fmt.Errorf("Unknown fault %s in %s, expected one of "+
+			"[aborted | unavailable | deadline | delay | slow]", kind, s)
+	}
+	return rule, nil
+}
+
+// The rules of the injector
+func (in *Injector) Rules() []Rule {
+	return append([]Rule(nil), in.rules...)
+}
+
+// Client options that add the interceptors to the Spanner client connection,
+// after any interceptors already on it
+func (in *Injector) ClientOptions() []option.ClientOption {
+	if len(in.rules) == 0 {
+		return nil
+	}
+	return []option.ClientOption{
+		option.WithGRPCDialOption(
+			grpc.WithChainUnaryInterceptor(in.UnaryInterceptor())),
+		option.WithGRPCDialOption(
+			grpc.WithChainStreamInterceptor(in.StreamInterceptor())),
+	}
+}
+
+// Interceptor that injects faults into unary calls
+func (in *Injector) UnaryInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{},
+		cc *grpc.ClientConn, invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption) error {
+		if err := in.before(ctx, method); err != nil {
+			return err
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// Interceptor that injects faults into streaming calls
+func (in *Injector) StreamInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc,
+		cc *grpc.ClientConn, method string, streamer grpc.Streamer,
+		opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if err := in.before(ctx, method); err != nil {
+			return nil, err
+		}
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range in.rules {
+			if r.Kind == FAULT_SLOW_STREAM && r.matches(method) && in.roll(r) {
+				inject(ctx, method, r)
+				cs = &slowStream{ClientStream: cs, ctx: ctx, delay: r.Delay}
+			}
+		}
+		return cs, nil
+	}
+}
+
+// Apply the delays and errors that match the method before the call
+func (in *Injector) before(ctx context.Context, method string) error {
+	for _, r := range in.rules {
+		if r.Kind == FAULT_SLOW_STREAM || !r.matches(method) || !in.roll(r) {
+			continue
+		}
+		inject(ctx, method, r)
+		if r.Kind == FAULT_DELAY {
+			if err := sleep(ctx, r.Delay); err != nil {
+				return err
+			}
+			continue
+		}
+		return status.Errorf(errorCodes[r.Kind], "injected fault %s in %s",
+			r.Kind, method)
+	}
+	return nil
+}
+
+// Whether to inject the fault of the rule into this call
+func (in *Injector) roll(r Rule) bool {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return in.rng.Float64() < r.Rate
+}
+
+// Annotate the span of the caller with the injected fault, so that it can be
+// told apart from real trouble in the trace
+func inject(ctx context.Context, method string, r Rule) {
+	trace.FromContext(ctx).Annotate([]trace.Attribute{
+		trace.StringAttribute("fault", r.Kind),
+		trace.StringAttribute("method", method),
+	}, "Injected fault")
+}
+
+// Wait for the delay unless the context is done first
+func sleep(ctx context.Context, delay time.Duration) error {
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+// A stream that waits before receiving each message
+type slowStream struct {
+	grpc.ClientStream
+	ctx   context.Context
+	delay time.Duration
+}
+
+func (s *slowStream) RecvMsg(m interface{}) error {
+	if err := sleep(s.ctx, s.delay); err != nil {
+		return err
+	}
+	return s.ClientStream.RecvMsg(m)
+}
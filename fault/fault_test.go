@@ -0,0 +1,205 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fault
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	COMMIT                = "/google.spanner.v1.Spanner/Commit"
+	EXECUTE_STREAMING_SQL = "/google.spanner.v1.Spanner/ExecuteStreamingSql"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []Rule
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"Commit:aborted@0.2", []Rule{{"Commit", FAULT_ABORTED, 0, 0.2}},
+			false},
+		{"*:delay=100ms@1, ExecuteStreamingSql:slow=20ms@0.5", []Rule{
+			{"*", FAULT_DELAY, 100 * time.Millisecond, 1},
+			{"ExecuteStreamingSql", FAULT_SLOW_STREAM, 20 * time.Millisecond,
+				0.5},
+		}, false},
+		{"Commit:aborted", nil, true},
+		{"Commit:aborted@2", nil, true},
+		{"Commit:aborted=1s@0.5", nil, true},
+		{"Commit:delay@0.5", nil, true},
+		{"Commit:crash@0.5", nil, true},
+	}
+	for _, tc := range tests {
+		in, err := Parse(tc.spec)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("Parse(%q) succeeded, want error", tc.spec)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q) error = %v", tc.spec, err)
+			continue
+		}
+		got := in.Rules()
+		if len(got) != len(tc.want) {
+			t.Errorf("Parse(%q) = %v, want %v", tc.spec, got, tc.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("Parse(%q) = %v, want %v", tc.spec, got, tc.want)
+			}
+		}
+	}
+}
+
+func TestUnaryInterceptor(t *testing.T) {
+	tests := []struct {
+		name   string
+		rules  []Rule
+		method string
+		code   codes.Code
+		called bool
+	}{
+		{"no rules", nil, COMMIT, codes.OK, true},
+		{"aborted", []Rule{{"Commit", FAULT_ABORTED, 0, 1}}, COMMIT,
+			codes.Aborted, false},
+		{"any method", []Rule{{ANY_METHOD, FAULT_UNAVAILABLE, 0, 1}}, COMMIT,
+			codes.Unavailable, false},
+		{"other method", []Rule{{"Rollback", FAULT_ABORTED, 0, 1}}, COMMIT,
+			codes.OK, true},
+		{"never", []Rule{{"Commit", FAULT_ABORTED, 0, 0}}, COMMIT, codes.OK,
+			true},
+		{"delay", []Rule{{"Commit", FAULT_DELAY, time.Millisecond, 1}},
+			COMMIT, codes.OK, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			called := false
+			invoker := func(context.Context, string, interface{},
+				interface{}, *grpc.ClientConn, ...grpc.CallOption) error {
+				called = true
+				return nil
+			}
+			err := New(tc.rules...).UnaryInterceptor()(context.Background(),
+				tc.method, nil, nil, nil, invoker)
+			if code := status.Code(err); code != tc.code {
+				t.Errorf("Interceptor returned %v, want code %v", err, tc.code)
+			}
+			if called != tc.called {
+				t.Errorf("Invoker called %t, want %t", called, tc.called)
+			}
+		})
+	}
+}
+
+func TestDelayRespectsDeadline(t *testing.T) {
+	in := New(Rule{"Commit", FAULT_DELAY, time.Hour, 1})
+	ctx, cancel := context.WithTimeout(context.Background(),
+		10*time.Millisecond)
+	defer cancel()
+	err := in.UnaryInterceptor()(ctx, COMMIT, nil, nil, nil,
+		func(context.Context, string, interface{}, interface{},
+			*grpc.ClientConn, ...grpc.CallOption) error {
+			t.Errorf("Invoker called after the deadline")
+			return nil
+		})
+	if code := status.Code(err); code != codes.DeadlineExceeded {
+		t.Errorf("Interceptor returned %v, want DeadlineExceeded", err)
+	}
+}
+
+// A stream that counts the messages received
+type countingStream struct {
+	grpc.ClientStream
+	received int
+}
+
+func (s *countingStream) RecvMsg(m interface{}) error {
+	s.received++
+	return nil
+}
+
+// Open a stream through the interceptor of the rules
+func openStream(t *testing.T, ctx context.Context,
+	rules ...Rule) (grpc.ClientStream, *countingStream) {
+	inner := &countingStream{}
+	streamer := func(context.Context, *grpc.StreamDesc, *grpc.ClientConn,
+		string, ...grpc.CallOption) (grpc.ClientStream, error) {
+		return inner, nil
+	}
+	cs, err := New(rules...).StreamInterceptor()(ctx, &grpc.StreamDesc{},
+		nil, EXECUTE_STREAMING_SQL, streamer)
+	if err != nil {
+		t.Fatalf("Interceptor returned %v", err)
+	}
+	return cs, inner
+}
+
+func TestSlowStream(t *testing.T) {
+	delay := 20 * time.Millisecond
+	cs, inner := openStream(t, context.Background(),
+		Rule{"ExecuteStreamingSql", FAULT_SLOW_STREAM, delay, 1})
+	for i := 0; i < 2; i++ {
+		start := time.Now()
+		if err := cs.RecvMsg(nil); err != nil {
+			t.Fatalf("RecvMsg() error = %v", err)
+		}
+		if elapsed := time.Since(start); elapsed < delay {
+			t.Errorf("RecvMsg() returned after %v, want at least %v", elapsed,
+				delay)
+		}
+	}
+	if inner.received != 2 {
+		t.Errorf("%d messages received, want 2", inner.received)
+	}
+
+	cs, inner = openStream(t, context.Background(),
+		Rule{"Commit", FAULT_SLOW_STREAM, time.Hour, 1})
+	if err := cs.RecvMsg(nil); err != nil || inner.received != 1 {
+		t.Errorf("RecvMsg() of another method = %v after %d messages", err,
+			inner.received)
+	}
+}
+
+func TestSlowStreamStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cs, inner := openStream(t, ctx,
+		Rule{"ExecuteStreamingSql", FAULT_SLOW_STREAM, time.Hour, 1})
+	time.AfterFunc(10*time.Millisecond, cancel)
+	done := make(chan error)
+	go func() { done <- cs.RecvMsg(nil) }()
+	select {
+	case err := <-done:
+		if code := status.Code(err); code != codes.Canceled {
+			t.Errorf("RecvMsg() returned %v, want Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("RecvMsg() still waiting after the context was cancelled")
+	}
+	if inner.received != 0 {
+		t.Errorf("%d messages received after the cancel, want 0",
+			inner.received)
+	}
+}
@@ -0,0 +1,303 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// End to end tests of every simulated action against the Spanner emulator.
+// Start the emulator and set SPANNER_EMULATOR_HOST to run them, for example
+//
+//	gcloud emulators spanner start &
+//	SPANNER_EMULATOR_HOST=localhost:9010 go test ./integration/
+//
+// The tests are skipped if the emulator is not available.
+package integration
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"cloud.google.com/go/spanner"
+	database "cloud.google.com/go/spanner/admin/database/apiv1"
+	instance "cloud.google.com/go/spanner/admin/instance/apiv1"
+	dbpb "google.golang.org/genproto/googleapis/spanner/admin/database/v1"
+	inpb "google.golang.org/genproto/googleapis/spanner/admin/instance/v1"
+	"google.golang.org/grpc/codes"
+
+	"github.com/GoogleCloudPlatform/opencensus-spanner-demo/query"
+	"github.com/GoogleCloudPlatform/opencensus-spanner-demo/spannerdb"
+	"github.com/GoogleCloudPlatform/opencensus-spanner-demo/testdata"
+	"github.com/GoogleCloudPlatform/opencensus-spanner-demo/update"
+)
+
+const (
+	PROJECT  = "projects/test-project"
+	INSTANCE = PROJECT + "/instances/test-instance"
+)
+
+// The schema from the README
+var schema = []string{
+	`CREATE TABLE Singers (
+  SingerId   INT64 NOT NULL,
+  FirstName  STRING(1024),
+  LastName   STRING(1024),
+  BirthDate  DATE,
+  LastUpdated TIMESTAMP OPTIONS (allow_commit_timestamp=true),
+) PRIMARY KEY(SingerId)`,
+	`CREATE INDEX SingersByLastName ON Singers(LastName)`,
+	`CREATE TABLE Albums (
+  SingerId        INT64 NOT NULL,
+  AlbumId         INT64 NOT NULL,
+  AlbumTitle      STRING(MAX),
+  MarketingBudget INT64,
+  CoverArt        BYTES(MAX),
+) PRIMARY KEY(SingerId, AlbumId),
+  INTERLEAVE IN PARENT Singers ON DELETE CASCADE`,
+}
+
+// Create a database with the schema in the emulator and connect to it. Skips
+// the test if the emulator is not available.
+func setup(t *testing.T) (spannerdb.Client, func()) {
+	host := os.Getenv(spannerdb.EMULATOR_HOST_ENV)
+	if host == "" {
+		t.Skipf("%s not set", spannerdb.EMULATOR_HOST_ENV)
+	}
+	conn, err := net.DialTimeout("tcp", host, 2*time.Second)
+	if err != nil {
+		t.Skipf("Spanner emulator not available at %s: %v", host, err)
+	}
+	conn.Close()
+
+	ctx := context.Background()
+	opts := spannerdb.EmulatorOptions()
+	ia, err := instance.NewInstanceAdminClient(ctx, opts...)
+	if err != nil {
+		t.Fatalf("Failed to create instance admin client: %v", err)
+	}
+	defer ia.Close()
+	iop, err := ia.CreateInstance(ctx, &inpb.CreateInstanceRequest{
+		Parent:     PROJECT,
+		InstanceId: "test-instance",
+		Instance: &inpb.Instance{
+			Config:      PROJECT + "/instanceConfigs/emulator-config",
+			DisplayName: "Test Instance",
+			NodeCount:   1,
+		},
+	})
+	if err == nil {
+		_, err = iop.Wait(ctx)
+	}
+	if err != nil && spanner.ErrCode(err) != codes.AlreadyExists {
+		t.Fatalf("Failed to create instance: %v", err)
+	}
+
+	da, err := database.NewDatabaseAdminClient(ctx, opts...)
+	if err != nil {
+		t.Fatalf("Failed to create database admin client: %v", err)
+	}
+	dbId := fmt.Sprintf("test-%d", time.Now().UnixNano()%1000000000)
+	dbName := INSTANCE + "/databases/" + dbId
+	dop, err := da.CreateDatabase(ctx, &dbpb.CreateDatabaseRequest{
+		Parent:          INSTANCE,
+		CreateStatement: "CREATE DATABASE `" + dbId + "`",
+		ExtraStatements: schema,
+	})
+	if err == nil {
+		_, err = dop.Wait(ctx)
+	}
+	if err != nil {
+		da.Close()
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	// Drop the database once the test and its deferred calls are done, so
+	// that repeated runs do not fill the emulator
+	t.Cleanup(func() {
+		defer da.Close()
+		err := da.DropDatabase(ctx, &dbpb.DropDatabaseRequest{
+			Database: dbName,
+		})
+		if err != nil {
+			t.Errorf("Failed to drop database %s: %v", dbName, err)
+		}
+	})
+
+	client, err := spanner.NewClient(ctx, dbName, opts...)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	return spannerdb.Wrap(client), client.Close
+}
+
+// The number of singers and albums in the database
+func countRows(t *testing.T, client spannerdb.Client) (int64, int64) {
+	ctx := context.Background()
+	singers, err := update.CountRows(ctx, client, "SingerId", "Singers")
+	if err != nil {
+		t.Fatalf("Failed to count singers: %v", err)
+	}
+	albums, err := update.CountRows(ctx, client, "AlbumId", "Albums")
+	if err != nil {
+		t.Fatalf("Failed to count albums: %v", err)
+	}
+	return singers, albums
+}
+
+// The title of the album with the given ids
+func albumTitle(t *testing.T, client spannerdb.Client,
+	singerId, albumId update.Key) string {
+	iter := client.Single().Query(context.Background(), spanner.Statement{
+		SQL: `SELECT AlbumTitle FROM Albums
+          WHERE SingerId = @SingerId AND AlbumId = @AlbumId`,
+		Params: map[string]interface{}{
+			"SingerId": singerId,
+			"AlbumId":  albumId,
+		},
+	})
+	defer iter.Stop()
+	row, err := iter.Next()
+	if err != nil {
+		t.Fatalf("Album %v %v not found: %v", singerId, albumId, err)
+	}
+	var title string
+	if err := row.Columns(&title); err != nil {
+		t.Fatalf("Failed to read album title: %v", err)
+	}
+	return title
+}
+
+func TestActions(t *testing.T) {
+	client, done := setup(t)
+	defer done()
+	ctx := context.Background()
+
+	// Seed a singer and album that the queries look for
+	seed, err := update.AddAllNoTxn(ctx, client, testdata.SingerAlbum{
+		FirstName:       "Captain",
+		LastName:        "Zero",
+		AlbumTitle:      "Rain on the Road",
+		BirthDate:       civil.Date{Year: 1985, Month: time.June, Day: 15},
+		MarketingBudget: 1000000000,
+	})
+	if err != nil {
+		t.Fatalf("Failed to seed data: %v", err)
+	}
+	if !seed.SingerCreated || !seed.AlbumCreated {
+		t.Fatalf("Seed data already exists: %+v", seed)
+	}
+	if singers, albums := countRows(t, client); singers != 1 || albums != 1 {
+		t.Fatalf("%d singers and %d albums after seeding, want 1 and 1",
+			singers, albums)
+	}
+	seedAlbum := fmt.Sprintf("%v %v Rain on the Road", seed.SingerId,
+		seed.AlbumId)
+
+	for _, action := range testdata.ACTIONS {
+		t.Run(action.String(), func(t *testing.T) {
+			singers, albums := countRows(t, client)
+			buf := &bytes.Buffer{}
+			var want string
+			var err error
+			var result *update.AddResult
+			data := testdata.RandomData()
+			switch action {
+			case testdata.ACTION_QUERY_ALBUMS:
+				err = query.QueryAlbums(ctx, client, buf)
+				want = seedAlbum
+			case testdata.ACTION_QUERY_LIMIT:
+				err = query.QueryAlbumsLimit(ctx, client, buf)
+				want = seedAlbum
+			case testdata.ACTION_QUERY_SINGERS_FIRST:
+				err = query.QuerySingersFirstName(ctx, client, buf)
+				want = fmt.Sprintf("%v Captain Zero", seed.SingerId)
+			case testdata.ACTION_QUERY_SINGERS_LAST:
+				err = query.QuerySingersLastName(ctx, client, buf)
+				want = fmt.Sprintf("%v Captain Zero", seed.SingerId)
+			case testdata.ACTION_JOIN_SINGER_ALBUM:
+				err = query.JoinSingerAlbum(ctx, client, buf)
+				want = fmt.Sprintf("%v Captain Rain on the Road",
+					seed.SingerId)
+			case testdata.ACTION_QUERY_SINGER_ALBUMS:
+				err = query.QuerySingerAlbums(ctx, client, buf, "Captain",
+					"Zero")
+				want = seedAlbum
+			case testdata.ACTION_QUERY_COVER_ART:
+				err = query.QueryAlbumCoverArt(ctx, client, buf, "Captain",
+					"Zero")
+				want = seedAlbum
+			case testdata.ACTION_QUERY_SINGERS_BORN:
+				err = query.QuerySingersBornBetween(ctx, client, buf,
+					civil.Date{Year: 1980, Month: time.January, Day: 1},
+					civil.Date{Year: 1990, Month: time.January, Day: 1})
+				want = fmt.Sprintf("%v Captain Zero", seed.SingerId)
+			case testdata.ACTION_QUERY_TOP_BUDGET:
+				err = query.QueryTopBudgetAlbums(ctx, client, buf)
+				want = seedAlbum
+			case testdata.ACTION_QUERY_RECENT_SINGERS:
+				err = query.QueryRecentlyUpdatedSingers(ctx, client, buf)
+				want = fmt.Sprintf("%v Captain Zero", seed.SingerId)
+			case testdata.ACTION_ADD_ALL_TXN:
+				result, err = update.AddAllTxn(ctx, client, data)
+			case testdata.ACTION_ADD_SINGLE_TXNS:
+				result, err = update.AddAllNoTxn(ctx, client, data)
+			default:
+				t.Fatalf("No test for action %v", action)
+			}
+			if err != nil {
+				t.Fatalf("%v failed: %v", action, err)
+			}
+			if want != "" && !strings.Contains(buf.String(), want) {
+				t.Errorf("%v returned %q, want %q", action, buf.String(), want)
+			}
+
+			newSingers, newAlbums := countRows(t, client)
+			if result == nil {
+				if newSingers != singers || newAlbums != albums {
+					t.Errorf("%v changed the row counts", action)
+				}
+				return
+			}
+			if !result.AlbumCreated {
+				t.Errorf("%v did not create album %s", action, data.AlbumTitle)
+			}
+			if result.SingerCreated && newSingers != singers+1 ||
+				!result.SingerCreated && newSingers != singers {
+				t.Errorf("%v: %d singers, was %d, singer created %t", action,
+					newSingers, singers, result.SingerCreated)
+			}
+			if newAlbums != albums+1 {
+				t.Errorf("%v: %d albums, was %d", action, newAlbums, albums)
+			}
+			if title := albumTitle(t, client, result.SingerId,
+				result.AlbumId); title != data.AlbumTitle {
+				t.Errorf("%v: album %v has title %q, want %q", action,
+					result.AlbumId, title, data.AlbumTitle)
+			}
+
+			// Adding the same singer and album again finds both
+			again, err := update.AddAllTxn(ctx, client, data)
+			if err != nil {
+				t.Fatalf("Adding %v again failed: %v", action, err)
+			}
+			if again.SingerCreated || again.AlbumCreated ||
+				again.AlbumId != result.AlbumId {
+				t.Errorf("Adding again returned %+v, want album %v found",
+					again, result.AlbumId)
+			}
+		})
+	}
+}
@@ -0,0 +1,248 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// In-memory OpenCensus trace and view exporters with assertions for tests, to
+// check the spans and metrics that the README walkthrough relies on.
+package recorder
+
+import (
+	"sync"
+	"testing"
+
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"go.opencensus.io/trace"
+)
+
+// The sampling probability of the default sampler of the OpenCensus trace
+// package
+const DEFAULT_SAMPLING_PROBABILITY = 1e-4
+
+var (
+	// The sampler applied by the recorders that are open, or the default
+	samplerMu sync.Mutex
+	sampler   = trace.ProbabilitySampler(DEFAULT_SAMPLING_PROBABILITY)
+)
+
+type Recorder struct {
+	mu    sync.Mutex
+	spans []*trace.SpanData
+	views []*view.Data
+	// The sampler to restore on Close
+	prev trace.Sampler
+}
+
+// Register a recorder as trace and view exporter and sample every trace.
+// Call Close to unregister it and restore the previous sampler.
+func New() *Recorder {
+	samplerMu.Lock()
+	defer samplerMu.Unlock()
+	r := &Recorder{prev: sampler}
+	trace.RegisterExporter(r)
+	view.RegisterExporter(r)
+	sampler = trace.AlwaysSample()
+	trace.ApplyConfig(trace.Config{DefaultSampler: sampler})
+	return r
+}
+
+// Unregister the recorder and restore the sampler in effect before New.
+// OpenCensus has no way to read the trace config, so that is the sampler of
+// an enclosing recorder or the default sampler, and a sampler applied with
+// trace.ApplyConfig outside of recorders has to be applied again.
+func (r *Recorder) Close() {
+	samplerMu.Lock()
+	defer samplerMu.Unlock()
+	trace.UnregisterExporter(r)
+	view.UnregisterExporter(r)
+	sampler = r.prev
+	trace.ApplyConfig(trace.Config{DefaultSampler: sampler})
+}
+
+func (r *Recorder) ExportSpan(s *trace.SpanData) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, s)
+}
+
+func (r *Recorder) ExportView(vd *view.Data) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.views = append(r.views, vd)
+}
+
+// Forget everything recorded so far
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = nil
+	r.views = nil
+}
+
+// The spans ended so far, in the order they ended
+func (r *Recorder) Spans() []*trace.SpanData {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*trace.SpanData(nil), r.spans...)
+}
+
+// The view data exported so far, which depends on the reporting period
+func (r *Recorder) Views() []*view.Data {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*view.Data(nil), r.views...)
+}
+
+// The first span with the given name, or nil
+func (r *Recorder) Span(name string) *trace.SpanData {
+	for _, s := range r.Spans() {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// The spans whose parent is the given span
+func (r *Recorder) Children(parent *trace.SpanData) []*trace.SpanData {
+	var children []*trace.SpanData
+	for _, s := range r.Spans() {
+		if s.ParentSpanID == parent.SpanID && s.TraceID == parent.TraceID {
+			children = append(children, s)
+		}
+	}
+	return children
+}
+
+// The first span with the given name below the parent, at any depth, or nil
+func (r *Recorder) Descendant(parent *trace.SpanData,
+	name string) *trace.SpanData {
+	for _, c := range r.Children(parent) {
+		if c.Name == name {
+			return c
+		}
+		if d := r.Descendant(c, name); d != nil {
+			return d
+		}
+	}
+	return nil
+}
+
+// Whether the span is below the ancestor, at any depth
+func (r *Recorder) IsDescendant(s, ancestor *trace.SpanData) bool {
+	byId := map[trace.SpanID]*trace.SpanData{}
+	for _, sd := range r.Spans() {
+		byId[sd.SpanID] = sd
+	}
+	for p := s; p != nil && p.TraceID == ancestor.TraceID; {
+		if p.ParentSpanID == ancestor.SpanID {
+			return true
+		}
+		p = byId[p.ParentSpanID]
+	}
+	return false
+}
+
+// Fail the test unless a span with the given name was recorded
+func (r *Recorder) AssertSpan(t testing.TB, name string) *trace.SpanData {
+	t.Helper()
+	s := r.Span(name)
+	if s == nil {
+		t.Fatalf("No span named %s in %v", name, r.names())
+	}
+	return s
+}
+
+// Fail the test unless a span with the given name is below the parent
+func (r *Recorder) AssertDescendant(t testing.TB, parent *trace.SpanData,
+	name string) *trace.SpanData {
+	t.Helper()
+	d := r.Descendant(parent, name)
+	if d == nil {
+		t.Fatalf("No span named %s below %s in %v", name, parent.Name,
+			r.names())
+	}
+	return d
+}
+
+// Fail the test unless the span has the attribute with the given value
+func AssertAttribute(t testing.TB, s *trace.SpanData, key string,
+	want interface{}) {
+	t.Helper()
+	got, ok := s.Attributes[key]
+	if !ok {
+		t.Errorf("Span %s has no attribute %s", s.Name, key)
+	} else if got != want {
+		t.Errorf("Span %s attribute %s = %v, want %v", s.Name, key, got, want)
+	}
+}
+
+// Fail the test unless the span ended with the given status code
+func AssertStatus(t testing.TB, s *trace.SpanData, code int32) {
+	t.Helper()
+	if s.Status.Code != code {
+		t.Errorf("Span %s status = %d (%s), want %d", s.Name, s.Status.Code,
+			s.Status.Message, code)
+	}
+}
+
+// The rows of a registered view with all the given tags. Reads the view
+// directly, so it does not wait for the reporting period.
+func ViewRows(t testing.TB, name string, tags ...tag.Tag) []*view.Row {
+	t.Helper()
+	rows, err := view.RetrieveData(name)
+	if err != nil {
+		t.Fatalf("Failed to retrieve view %s: %v", name, err)
+	}
+	var matched []*view.Row
+	for _, row := range rows {
+		if hasTags(row, tags) {
+			matched = append(matched, row)
+		}
+	}
+	return matched
+}
+
+// Fail the test unless the view has a row with all the given tags
+func AssertViewRow(t testing.TB, name string, tags ...tag.Tag) *view.Row {
+	t.Helper()
+	rows := ViewRows(t, name, tags...)
+	if len(rows) == 0 {
+		t.Fatalf("No row in view %s with tags %v", name, tags)
+	}
+	return rows[0]
+}
+
+func hasTags(row *view.Row, tags []tag.Tag) bool {
+	for _, want := range tags {
+		found := false
+		for _, got := range row.Tags {
+			if got == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Recorder) names() []string {
+	var names []string
+	for _, s := range r.Spans() {
+		names = append(names, s.Name)
+	}
+	return names
+}
@@ -0,0 +1,400 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// In-memory fake of the spannerdb.Client interface for unit tests. New tests
+// of the query and update packages should use this fake. The gRPC fake in
+// internal/spannerfake is only for tests that need the real client library,
+// like the spans and retries of Spanner calls.
+package spannerdbfake
+
+/**
+  The fake understands just
+  enough SQL for the statements in this application: a SELECT list of columns,
+  an optional join of Albums to Singers, equality and range conditions on
+  parameters, equality on string literals and IS NOT NULL combined with AND,
+  ORDER BY a single column and LIMIT, plus INSERT of parameters and
+  PENDING_COMMIT_TIMESTAMP() and COUNT of a table. Null values of the spanner
+  package are stored as nil or the plain value.
+ **/
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"cloud.google.com/go/spanner"
+	"google.golang.org/api/iterator"
+
+	"github.com/GoogleCloudPlatform/opencensus-spanner-demo/spannerdb"
+)
+
+// A row in a fake table, by column name
+type Record map[string]interface{}
+
+var (
+	countRe   = regexp.MustCompile(`(?is)SELECT\s+COUNT\(.*?\)\s+FROM\s+(\w+)`)
+	selectRe  = regexp.MustCompile(`(?is)SELECT\s+(.*?)\s+FROM\s+(\w+)`)
+	joinRe    = regexp.MustCompile(`(?is)\sJOIN\s+(\w+)`)
+	paramRe   = regexp.MustCompile(`(?:\w+\.)?(\w+)\s*=\s*@(\w+)`)
+	rangeRe   = regexp.MustCompile(`(?:\w+\.)?(\w+)\s*(<=|>=|<|>)\s*@(\w+)`)
+	notNullRe = regexp.MustCompile(`(?is)(?:\w+\.)?(\w+)\s+IS\s+NOT\s+NULL`)
+	literalRe = regexp.MustCompile(`(?:\w+\.)?(\w+)\s*=\s*'([^']*)'`)
+	orderRe   = regexp.MustCompile(`(?is)ORDER\s+BY\s+(?:\w+\.)?(\w+)(\s+DESC)?`)
+	limitRe   = regexp.MustCompile(`(?is)LIMIT\s+(\d+)`)
+	insertRe  = regexp.MustCompile(`(?is)INSERT\s+(?:INTO\s+)?(\w+)\s*\(([^)]*)\)\s*VALUES\s*\((.*)\)`)
+)
+
+// A statement that should fail
+type failure struct {
+	fragment string
+	err      error
+}
+
+type Fake struct {
+	mu       sync.Mutex
+	tables   map[string][]Record
+	failures []failure
+	stmts    []string
+}
+
+// Create an empty fake database
+func New() *Fake {
+	return &Fake{tables: map[string][]Record{}}
+}
+
+// Add rows to a table
+func (f *Fake) Insert(table string, records ...Record) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tables[table] = append(f.tables[table], records...)
+}
+
+// The rows of a table
+func (f *Fake) Rows(table string) []Record {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Record(nil), f.tables[table]...)
+}
+
+// Fail every statement whose SQL contains the fragment with the error
+func (f *Fake) FailOn(fragment string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures = append(f.failures, failure{fragment, err})
+}
+
+// The SQL of every statement run so far
+func (f *Fake) Statements() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.stmts...)
+}
+
+func (f *Fake) Single() spannerdb.Reader {
+	return fakeReader{f}
+}
+
+func (f *Fake) ReadOnlyTransaction() spannerdb.ReadOnlyTransaction {
+	return fakeReader{f}
+}
+
+// Run the function against a copy of the tables, which replaces the tables
+// only if the function succeeds
+func (f *Fake) ReadWriteTransaction(ctx context.Context,
+	fn func(context.Context, spannerdb.ReadWriteTransaction) error) (time.Time,
+	error) {
+	f.mu.Lock()
+	txn := &fakeTxn{f: f, tables: map[string][]Record{}}
+	for name, rows := range f.tables {
+		txn.tables[name] = append([]Record(nil), rows...)
+	}
+	f.mu.Unlock()
+	if err := fn(ctx, txn); err != nil {
+		return time.Time{}, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tables = txn.tables
+	return time.Now(), nil
+}
+
+// Record the statement and return the error it should fail with, if any
+func (f *Fake) check(stmt spanner.Statement) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stmts = append(f.stmts, stmt.SQL)
+	for _, fl := range f.failures {
+		if strings.Contains(stmt.SQL, fl.fragment) {
+			return fl.err
+		}
+	}
+	return nil
+}
+
+type fakeReader struct {
+	f *Fake
+}
+
+func (r fakeReader) Query(ctx context.Context,
+	stmt spanner.Statement) spannerdb.RowIterator {
+	if err := r.f.check(stmt); err != nil {
+		return &fakeIterator{err: err}
+	}
+	r.f.mu.Lock()
+	defer r.f.mu.Unlock()
+	rows, err := query(r.f.tables, stmt)
+	return &fakeIterator{rows: rows, err: err}
+}
+
+func (r fakeReader) Close() {}
+
+type fakeTxn struct {
+	f      *Fake
+	tables map[string][]Record
+}
+
+func (t *fakeTxn) Query(ctx context.Context,
+	stmt spanner.Statement) spannerdb.RowIterator {
+	if err := t.f.check(stmt); err != nil {
+		return &fakeIterator{err: err}
+	}
+	rows, err := query(t.tables, stmt)
+	return &fakeIterator{rows: rows, err: err}
+}
+
+func (t *fakeTxn) Update(ctx context.Context,
+	stmt spanner.Statement) (int64, error) {
+	if err := t.f.check(stmt); err != nil {
+		return 0, err
+	}
+	m := insertRe.FindStringSubmatch(stmt.SQL)
+	if m == nil {
+		return 0, fmt.Errorf("Fake does not support statement %s", stmt.SQL)
+	}
+	columns := strings.Split(m[2], ",")
+	values := strings.Split(strings.Replace(m[3], "()", "", -1), ",")
+	if len(columns) != len(values) {
+		return 0, fmt.Errorf("Fake found %d columns and %d values in %s",
+			len(columns), len(values), stmt.SQL)
+	}
+	rec := Record{}
+	for i, col := range columns {
+		col = strings.TrimSpace(col)
+		value := strings.TrimSpace(values[i])
+		switch {
+		case strings.HasPrefix(value, "@"):
+			rec[col] = plain(stmt.Params[value[1:]])
+		case strings.EqualFold(value, "PENDING_COMMIT_TIMESTAMP"):
+			rec[col] = time.Now()
+		default:
+			return 0, fmt.Errorf("Fake does not support value %s in %s",
+				value, stmt.SQL)
+		}
+	}
+	t.tables[m[1]] = append(t.tables[m[1]], rec)
+	return 1, nil
+}
+
+type fakeIterator struct {
+	rows []*spanner.Row
+	err  error
+}
+
+func (it *fakeIterator) Next() (*spanner.Row, error) {
+	if it.err != nil {
+		return nil, it.err
+	}
+	if len(it.rows) == 0 {
+		return nil, iterator.Done
+	}
+	row := it.rows[0]
+	it.rows = it.rows[1:]
+	return row, nil
+}
+
+func (it *fakeIterator) Stop() {}
+
+// Run a query against the tables
+func query(tables map[string][]Record,
+	stmt spanner.Statement) ([]*spanner.Row, error) {
+	if m := countRe.FindStringSubmatch(stmt.SQL); m != nil {
+		row, err := spanner.NewRow([]string{""},
+			[]interface{}{int64(len(tables[m[1]]))})
+		return []*spanner.Row{row}, err
+	}
+	m := selectRe.FindStringSubmatch(stmt.SQL)
+	if m == nil {
+		return nil, fmt.Errorf("Fake does not support statement %s", stmt.SQL)
+	}
+	var columns []string
+	for _, col := range strings.Split(m[1], ",") {
+		col = strings.TrimSpace(col)
+		if i := strings.LastIndex(col, "."); i >= 0 {
+			col = col[i+1:]
+		}
+		columns = append(columns, col)
+	}
+	records := tables[m[2]]
+	if j := joinRe.FindStringSubmatch(stmt.SQL); j != nil {
+		records = join(records, tables[j[1]])
+	}
+	where := stmt.SQL
+	if i := strings.Index(strings.ToUpper(where), "WHERE"); i >= 0 {
+		where = where[i:]
+	} else {
+		where = ""
+	}
+	var matched []Record
+	for _, rec := range records {
+		if matches(rec, where, stmt.Params) {
+			matched = append(matched, rec)
+		}
+	}
+	if o := orderRe.FindStringSubmatch(stmt.SQL); o != nil {
+		desc := o[2] != ""
+		sort.SliceStable(matched, func(i, j int) bool {
+			if desc {
+				return less(matched[j][o[1]], matched[i][o[1]])
+			}
+			return less(matched[i][o[1]], matched[j][o[1]])
+		})
+	}
+	if l := limitRe.FindStringSubmatch(stmt.SQL); l != nil {
+		n, _ := strconv.Atoi(l[1])
+		if n < len(matched) {
+			matched = matched[:n]
+		}
+	}
+	var rows []*spanner.Row
+	for _, rec := range matched {
+		values := make([]interface{}, len(columns))
+		for i, col := range columns {
+			values[i] = rec[col]
+		}
+		row, err := spanner.NewRow(columns, values)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// Join child rows to their parent rows by SingerId
+func join(parents, children []Record) []Record {
+	var joined []Record
+	for _, p := range parents {
+		for _, c := range children {
+			if p["SingerId"] != c["SingerId"] {
+				continue
+			}
+			rec := Record{}
+			for k, v := range c {
+				rec[k] = v
+			}
+			for k, v := range p {
+				rec[k] = v
+			}
+			joined = append(joined, rec)
+		}
+	}
+	return joined
+}
+
+// Check the equality conditions of a WHERE clause
+func matches(rec Record, where string, params map[string]interface{}) bool {
+	for _, m := range paramRe.FindAllStringSubmatch(where, -1) {
+		if rec[m[1]] != params[m[2]] {
+			return false
+		}
+	}
+	for _, m := range literalRe.FindAllStringSubmatch(where, -1) {
+		if rec[m[1]] != m[2] {
+			return false
+		}
+	}
+	for _, m := range rangeRe.FindAllStringSubmatch(where, -1) {
+		v, p := rec[m[1]], params[m[3]]
+		var ok bool
+		switch m[2] {
+		case "<":
+			ok = less(v, p)
+		case "<=":
+			ok = less(v, p) || v == p
+		case ">":
+			ok = less(p, v)
+		case ">=":
+			ok = less(p, v) || v == p
+		}
+		if !ok {
+			return false
+		}
+	}
+	for _, m := range notNullRe.FindAllStringSubmatch(where, -1) {
+		if rec[m[1]] == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Whether a sorts before b. Values of different types, including nil, do not.
+func less(a, b interface{}) bool {
+	switch a := a.(type) {
+	case int64:
+		b, ok := b.(int64)
+		return ok && a < b
+	case string:
+		b, ok := b.(string)
+		return ok && a < b
+	case civil.Date:
+		b, ok := b.(civil.Date)
+		return ok && a.Before(b)
+	case time.Time:
+		b, ok := b.(time.Time)
+		return ok && a.Before(b)
+	}
+	return false
+}
+
+// The plain value or nil for the null types of the spanner package
+func plain(v interface{}) interface{} {
+	switch v := v.(type) {
+	case spanner.NullInt64:
+		if v.Valid {
+			return v.Int64
+		}
+	case spanner.NullString:
+		if v.Valid {
+			return v.StringVal
+		}
+	case spanner.NullDate:
+		if v.Valid {
+			return v.Date
+		}
+	case spanner.NullTime:
+		if v.Valid {
+			return v.Time
+		}
+	default:
+		return v
+	}
+	return nil
+}
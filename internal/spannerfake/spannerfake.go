@@ -0,0 +1,223 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// In-process fake of the Spanner gRPC service for tests. Queries are answered
+// with canned results chosen by a fragment of the SQL text and DML statements
+// report a single row changed. Nothing is stored. Tests that only need the
+// results of statements should use the in-memory internal/spannerdbfake.
+package spannerfake
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/spanner"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/empty"
+	structpb "github.com/golang/protobuf/ptypes/struct"
+	"go.opencensus.io/plugin/ocgrpc"
+	"google.golang.org/api/option"
+	sppb "google.golang.org/genproto/googleapis/spanner/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const DATABASE = "projects/p/instances/i/databases/d"
+
+// A canned result for queries containing a fragment of SQL
+type result struct {
+	fragment string
+	rs       *sppb.ResultSet
+}
+
+type Server struct {
+	// Embedded so that the server satisfies the interface, the methods the
+	// client does not use are left nil and panic if called
+	sppb.SpannerServer
+
+	mu       sync.Mutex
+	results  []result
+	sessions int
+	txns     int
+	queries  []string
+
+	lis *bufconn.Listener
+	srv *grpc.Server
+}
+
+// Start a fake Spanner service listening in memory
+func New() *Server {
+	s := &Server{
+		lis: bufconn.Listen(1 << 20),
+		srv: grpc.NewServer(),
+	}
+	sppb.RegisterSpannerServer(s.srv, s)
+	go s.srv.Serve(s.lis)
+	return s
+}
+
+// Create a Spanner client connected to the fake. The connection carries the
+// OpenCensus gRPC client handler, as a connection to Cloud Spanner does.
+func (s *Server) Client(ctx context.Context) (*spanner.Client, error) {
+	conn, err := grpc.DialContext(ctx, "bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn,
+			error) {
+			return s.lis.Dial()
+		}),
+		grpc.WithInsecure(),
+		grpc.WithStatsHandler(&ocgrpc.ClientHandler{}))
+	if err != nil {
+		return nil, err
+	}
+	return spanner.NewClientWithConfig(ctx, DATABASE,
+		spanner.ClientConfig{NumChannels: 1}, option.WithGRPCConn(conn))
+}
+
+// Stop the service
+func (s *Server) Close() {
+	s.srv.Stop()
+}
+
+// Answer queries whose SQL contains the fragment with the given columns and
+// rows. Values may be int64 or string. Later results take precedence.
+func (s *Server) AddResult(fragment string, columns []string,
+	rows ...[]interface{}) {
+	rs := &sppb.ResultSet{Metadata: &sppb.ResultSetMetadata{
+		RowType: &sppb.StructType{},
+	}}
+	for i, name := range columns {
+		code := sppb.TypeCode_STRING
+		if len(rows) > 0 {
+			if _, ok := rows[0][i].(int64); ok {
+				code = sppb.TypeCode_INT64
+			}
+		}
+		rs.Metadata.RowType.Fields = append(rs.Metadata.RowType.Fields,
+			&sppb.StructType_Field{Name: name, Type: &sppb.Type{Code: code}})
+	}
+	for _, row := range rows {
+		lv := &structpb.ListValue{}
+		for _, v := range row {
+			lv.Values = append(lv.Values, &structpb.Value{
+				Kind: &structpb.Value_StringValue{StringValue: fmt.Sprint(v)},
+			})
+		}
+		rs.Rows = append(rs.Rows, lv)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results = append([]result{{fragment, rs}}, s.results...)
+}
+
+// The SQL of every statement executed so far
+func (s *Server) Queries() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.queries...)
+}
+
+func (s *Server) resultFor(sql string) *sppb.ResultSet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queries = append(s.queries, sql)
+	if strings.HasPrefix(strings.TrimSpace(strings.ToUpper(sql)), "INSERT") {
+		return &sppb.ResultSet{
+			Metadata: &sppb.ResultSetMetadata{RowType: &sppb.StructType{}},
+			Stats: &sppb.ResultSetStats{
+				RowCount: &sppb.ResultSetStats_RowCountExact{RowCountExact: 1},
+			},
+		}
+	}
+	for _, r := range s.results {
+		if strings.Contains(sql, r.fragment) {
+			return r.rs
+		}
+	}
+	return &sppb.ResultSet{
+		Metadata: &sppb.ResultSetMetadata{RowType: &sppb.StructType{}},
+	}
+}
+
+func (s *Server) CreateSession(ctx context.Context,
+	req *sppb.CreateSessionRequest) (*sppb.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions++
+	name := fmt.Sprintf("%s/sessions/%d", req.Database, s.sessions)
+	return &sppb.Session{Name: name}, nil
+}
+
+func (s *Server) BatchCreateSessions(ctx context.Context,
+	req *sppb.BatchCreateSessionsRequest) (*sppb.BatchCreateSessionsResponse,
+	error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	resp := &sppb.BatchCreateSessionsResponse{}
+	for i := int32(0); i < req.SessionCount; i++ {
+		s.sessions++
+		resp.Session = append(resp.Session, &sppb.Session{
+			Name: fmt.Sprintf("%s/sessions/%d", req.Database, s.sessions),
+		})
+	}
+	return resp, nil
+}
+
+func (s *Server) GetSession(ctx context.Context,
+	req *sppb.GetSessionRequest) (*sppb.Session, error) {
+	return &sppb.Session{Name: req.Name}, nil
+}
+
+func (s *Server) DeleteSession(ctx context.Context,
+	req *sppb.DeleteSessionRequest) (*empty.Empty, error) {
+	return &empty.Empty{}, nil
+}
+
+func (s *Server) BeginTransaction(ctx context.Context,
+	req *sppb.BeginTransactionRequest) (*sppb.Transaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.txns++
+	return &sppb.Transaction{
+		Id:            []byte(fmt.Sprintf("txn-%d", s.txns)),
+		ReadTimestamp: ptypes.TimestampNow(),
+	}, nil
+}
+
+func (s *Server) Commit(ctx context.Context,
+	req *sppb.CommitRequest) (*sppb.CommitResponse, error) {
+	return &sppb.CommitResponse{CommitTimestamp: ptypes.TimestampNow()}, nil
+}
+
+func (s *Server) Rollback(ctx context.Context,
+	req *sppb.RollbackRequest) (*empty.Empty, error) {
+	return &empty.Empty{}, nil
+}
+
+func (s *Server) ExecuteSql(ctx context.Context,
+	req *sppb.ExecuteSqlRequest) (*sppb.ResultSet, error) {
+	return s.resultFor(req.Sql), nil
+}
+
+func (s *Server) ExecuteStreamingSql(req *sppb.ExecuteSqlRequest,
+	stream sppb.Spanner_ExecuteStreamingSqlServer) error {
+	rs := s.resultFor(req.Sql)
+	prs := &sppb.PartialResultSet{Metadata: rs.Metadata, Stats: rs.Stats}
+	for _, row := range rs.Rows {
+		prs.Values = append(prs.Values, row.Values...)
+	}
+	return stream.Send(prs)
+}
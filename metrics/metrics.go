@@ -0,0 +1,117 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Application metrics recorded by the query and update packages
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"go.opencensus.io/trace"
+
+	"github.com/GoogleCloudPlatform/opencensus-spanner-demo/update"
+)
+
+const (
+	DIRECTION_READ  = "read"
+	DIRECTION_WRITE = "write"
+)
+
+var (
+	KeyAction     = tag.MustNewKey("action")
+	KeyDirection  = tag.MustNewKey("direction")
+	KeyErrorClass = tag.MustNewKey("error_class")
+
+	PayloadBytes = stats.Int64("payload_size",
+		"Size of the album data read or written", stats.UnitBytes)
+
+	PayloadSizeView = &view.View{
+		Name:        "payload_size",
+		Description: "Distribution of album payload sizes by action",
+		Measure:     PayloadBytes,
+		Aggregation: view.Distribution(0, 256, 1024, 4096, 16384, 65536,
+			262144, 1048576, 4194304, 10485760),
+		TagKeys: []tag.Key{KeyAction, KeyDirection, KeyErrorClass},
+	}
+
+	ActionLatency = stats.Float64("action_latency",
+		"Latency of each action in the simulation", stats.UnitMilliseconds)
+
+	ActionLatencyView = &view.View{
+		Name:        "action_latency",
+		Description: "Distribution of action latencies by action and error class",
+		Measure:     ActionLatency,
+		Aggregation: view.Distribution(0, 5, 10, 25, 50, 100, 250, 500, 1000,
+			2500, 5000, 10000, 30000),
+		TagKeys: []tag.Key{KeyAction, KeyErrorClass},
+	}
+
+	ActionCountView = &view.View{
+		Name:        "action_count",
+		Description: "Count of actions by action and error class",
+		Measure:     ActionLatency,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{KeyAction, KeyErrorClass},
+	}
+
+	Views = []*view.View{PayloadSizeView, ActionLatencyView, ActionCountView}
+)
+
+// Record the payload size of an action on its span and in the size
+// distribution, tagged with the class of the error the action ended with
+func RecordPayload(ctx context.Context, action, direction string, err error,
+	size int64) {
+	span := trace.FromContext(ctx)
+	if span != nil {
+		span.AddAttributes(trace.Int64Attribute("payload_bytes", size))
+	}
+	stats.RecordWithTags(ctx, []tag.Mutator{
+		tag.Upsert(KeyAction, action),
+		tag.Upsert(KeyDirection, direction),
+		tag.Upsert(KeyErrorClass, update.Classify(err)),
+	}, PayloadBytes.M(size))
+}
+
+// Record the latency of an action, tagged with the class of the error it
+// ended with
+func RecordAction(ctx context.Context, action string, err error,
+	latency time.Duration) {
+	stats.RecordWithTags(ctx, []tag.Mutator{
+		tag.Upsert(KeyAction, action),
+		tag.Upsert(KeyErrorClass, update.Classify(err)),
+	}, ActionLatency.M(float64(latency)/float64(time.Millisecond)))
+}
+
+// Set the status of a span from the gRPC code of the error and add error
+// attributes, so that failed actions can be filtered in trace UIs. Does nothing
+// if there is no error.
+func SetSpanStatus(span *trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	code := update.StatusCode(err)
+	span.AddAttributes(
+		trace.BoolAttribute("error", true),
+		trace.StringAttribute("error_class", update.Classify(err)),
+		trace.StringAttribute("error.code", code.String()),
+		trace.StringAttribute("error.message", err.Error()))
+	span.SetStatus(trace.Status{
+		Code:    int32(code),
+		Message: err.Error(),
+	})
+}
@@ -0,0 +1,70 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"go.opencensus.io/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/GoogleCloudPlatform/opencensus-spanner-demo/internal/recorder"
+	"github.com/GoogleCloudPlatform/opencensus-spanner-demo/update"
+)
+
+func TestRecordPayload(t *testing.T) {
+	if err := view.Register(PayloadSizeView); err != nil {
+		t.Fatalf("Failed to register view: %v", err)
+	}
+	defer view.Unregister(PayloadSizeView)
+	rec := recorder.New()
+	defer rec.Close()
+
+	ctx, span := trace.StartSpan(context.Background(), "add")
+	RecordPayload(ctx, "AddAllInBigTransaction", DIRECTION_WRITE, nil, 300)
+	span.End()
+	RecordPayload(context.Background(), "QueryAlbums", DIRECTION_READ,
+		status.Error(codes.DeadlineExceeded, "deadline"), 5000)
+
+	recorder.AssertAttribute(t, rec.AssertSpan(t, "add"), "payload_bytes",
+		int64(300))
+	tests := []struct {
+		action, direction, class string
+		bucket                   int
+	}{
+		// OpenCensus drops the 0 bound, so the buckets start [0, 256),
+		// [256, 1024), [1024, 4096), [4096, 16384)
+		{"AddAllInBigTransaction", DIRECTION_WRITE, update.ERROR_NONE, 1},
+		{"QueryAlbums", DIRECTION_READ, update.ERROR_DEADLINE_EXCEEDED, 3},
+	}
+	for _, tc := range tests {
+		row := recorder.AssertViewRow(t, "payload_size",
+			tag.Tag{Key: KeyAction, Value: tc.action},
+			tag.Tag{Key: KeyDirection, Value: tc.direction},
+			tag.Tag{Key: KeyErrorClass, Value: tc.class})
+		dist, ok := row.Data.(*view.DistributionData)
+		if !ok {
+			t.Fatalf("payload_size row is %T, want a distribution", row.Data)
+		}
+		if dist.Count != 1 || dist.CountPerBucket[tc.bucket] != 1 {
+			t.Errorf("%s %s sizes in buckets %v, want one in bucket %d",
+				tc.action, tc.direction, dist.CountPerBucket, tc.bucket)
+		}
+	}
+}
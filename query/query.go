@@ -20,63 +20,146 @@ import (
 	"fmt"
 	"io"
 
+	"cloud.google.com/go/civil"
 	"cloud.google.com/go/spanner"
 	"go.opencensus.io/trace"
 	"google.golang.org/api/iterator"
 
 	log "github.com/GoogleCloudPlatform/opencensus-spanner-demo/applog"
+	"github.com/GoogleCloudPlatform/opencensus-spanner-demo/metrics"
+	"github.com/GoogleCloudPlatform/opencensus-spanner-demo/spannerdb"
+	"github.com/GoogleCloudPlatform/opencensus-spanner-demo/testdata"
 )
 
 // Queries albums and singers with a join
-func JoinSingerAlbum(ctx context.Context, client *spanner.Client,
-	w io.Writer) {
+func JoinSingerAlbum(ctx context.Context, client spannerdb.Client,
+	w io.Writer) error {
 	ctx, span := trace.StartSpan(ctx, "join-singer-album")
 	defer span.End()
 	q := `SELECT s.SingerId, s.FirstName, a.AlbumTitle
 				FROM Singers AS s
 				JOIN Albums AS a ON s.SingerId = a.SingerId;`
-	err := querySingers(span, ctx, client, w, q)
+	err := querySingers(ctx, client, w, spanner.Statement{SQL: q},
+		testdata.ACTION_JOIN_SINGER_ALBUM)
 	if err != nil {
 		log.Errorf(ctx, "JoinSingerAlbum Error %v", err)
+		metrics.SetSpanStatus(span, err)
 	}
+	return err
 }
 
 // Queries albums in the Spanner database
-func QueryAlbums(ctx context.Context, client *spanner.Client, w io.Writer) {
+func QueryAlbums(ctx context.Context, client spannerdb.Client,
+	w io.Writer) error {
 	// [START spannerlab_query_albums_span]
 	ctx, span := trace.StartSpan(ctx, "query-albums")
 	defer span.End()
 	// [END spannerlab_query_albums_span]
 	q := `SELECT SingerId, AlbumId, AlbumTitle FROM Albums`
-	err := queryAlbums(ctx, client, w, q)
+	err := queryAlbums(ctx, client, w, spanner.Statement{SQL: q},
+		testdata.ACTION_QUERY_ALBUMS)
 	if err != nil {
 		log.Errorf(ctx, "Error querying albums %v for query %s", err, q)
+		metrics.SetSpanStatus(span, err)
 	}
+	return err
 }
 
 // Queries albums in the Spanner database with a limit
-func QueryAlbumsLimit(ctx context.Context, client *spanner.Client,
-	w io.Writer) {
+func QueryAlbumsLimit(ctx context.Context, client spannerdb.Client,
+	w io.Writer) error {
 	ctx, span := trace.StartSpan(ctx, "query-limit")
 	defer span.End()
 	q := `SELECT SingerId, AlbumId, AlbumTitle FROM Albums LIMIT 10`
-	err := queryAlbums(ctx, client, w, q)
+	err := queryAlbums(ctx, client, w, spanner.Statement{SQL: q},
+		testdata.ACTION_QUERY_LIMIT)
 	if err != nil {
 		log.Printf(ctx, "QueryLimit Error %v", err)
+		metrics.SetSpanStatus(span, err)
 	}
+	return err
 }
 
-// Execute a query with no parameters
-func queryAlbums(ctx context.Context, client *spanner.Client, w io.Writer,
-	q string) error {
+// Queries the albums of one singer by name, a point read of the keys chosen
+// by the access distribution
+func QuerySingerAlbums(ctx context.Context, client spannerdb.Client,
+	w io.Writer, firstName, lastName string) error {
+	ctx, span := trace.StartSpan(ctx, "query-singer-albums")
+	defer span.End()
+	stmt := spanner.Statement{
+		SQL: `SELECT a.SingerId, a.AlbumId, a.AlbumTitle
+				FROM Singers AS s
+				JOIN Albums AS a ON s.SingerId = a.SingerId
+				WHERE s.FirstName = @FirstName AND s.LastName = @LastName`,
+		Params: map[string]interface{}{
+			"FirstName": firstName,
+			"LastName":  lastName,
+		},
+	}
+	err := queryAlbums(ctx, client, w, stmt,
+		testdata.ACTION_QUERY_SINGER_ALBUMS)
+	if err != nil {
+		log.Printf(ctx, "QuerySingerAlbums Error %v", err)
+		metrics.SetSpanStatus(span, err)
+	}
+	return err
+}
+
+// Queries the albums of one singer by name with their cover art, which needs
+// the CoverArt column described in the README
+func QueryAlbumCoverArt(ctx context.Context, client spannerdb.Client,
+	w io.Writer, firstName, lastName string) error {
+	ctx, span := trace.StartSpan(ctx, "query-cover-art")
+	defer span.End()
+	stmt := spanner.Statement{
+		SQL: `SELECT a.SingerId, a.AlbumId, a.AlbumTitle, a.CoverArt
+				FROM Singers AS s
+				JOIN Albums AS a ON s.SingerId = a.SingerId
+				WHERE s.FirstName = @FirstName AND s.LastName = @LastName`,
+		Params: map[string]interface{}{
+			"FirstName": firstName,
+			"LastName":  lastName,
+		},
+	}
+	err := queryAlbums(ctx, client, w, stmt, testdata.ACTION_QUERY_COVER_ART)
+	if err != nil {
+		log.Printf(ctx, "QueryAlbumCoverArt Error %v", err)
+		metrics.SetSpanStatus(span, err)
+	}
+	return err
+}
+
+// Queries the ten albums with the largest marketing budget (no index, a full
+// scan)
+func QueryTopBudgetAlbums(ctx context.Context, client spannerdb.Client,
+	w io.Writer) error {
+	ctx, span := trace.StartSpan(ctx, "query-top-budget")
+	defer span.End()
+	q := `SELECT SingerId, AlbumId, AlbumTitle FROM Albums
+				WHERE MarketingBudget IS NOT NULL
+				ORDER BY MarketingBudget DESC LIMIT 10`
+	err := queryAlbums(ctx, client, w, spanner.Statement{SQL: q},
+		testdata.ACTION_QUERY_TOP_BUDGET)
+	if err != nil {
+		log.Printf(ctx, "QueryTopBudgetAlbums Error %v", err)
+		metrics.SetSpanStatus(span, err)
+	}
+	return err
+}
+
+// Execute a query for albums, recording the size of the results against the
+// given action. The cover art is read and counted if the query selects it as
+// a fourth column.
+func queryAlbums(ctx context.Context, client spannerdb.Client, w io.Writer,
+	stmt spanner.Statement, action testdata.Action) error {
 	// [START querylbums_ReadOnlyTransaction]
 	ro := client.ReadOnlyTransaction()
 	defer ro.Close()
 	// [END querylbums_ReadOnlyTransaction]
-	stmt := spanner.Statement{SQL: q}
 	iter := ro.Query(ctx, stmt)
 	defer iter.Stop()
 	counter := 0
+	var size int64
 	for {
 		row, err := iter.Next()
 		if err == iterator.Done {
@@ -85,55 +168,123 @@ func queryAlbums(ctx context.Context, client *spanner.Client, w io.Writer,
 		if err != nil {
 			return err
 		}
-		var singerID int64
-		var albumID int64
+		singerID, err := spannerdb.ColumnKey(row, 0)
+		if err != nil {
+			return err
+		}
+		albumID, err := spannerdb.ColumnKey(row, 1)
+		if err != nil {
+			return err
+		}
 		var albumTitle string
-		if err := row.Columns(&singerID, &albumID, &albumTitle); err != nil {
+		if err := row.Column(2, &albumTitle); err != nil {
 			return err
 		}
+		var coverArt []byte
+		if row.Size() > 3 {
+			if err := row.Column(3, &coverArt); err != nil {
+				return err
+			}
+		}
 		counter++
-		fmt.Fprintf(w, "%d %d %s", singerID, albumID, albumTitle)
+		size += int64(len(albumTitle) + len(coverArt))
+		fmt.Fprintf(w, "%v %v %s", singerID, albumID, albumTitle)
 	}
-	log.Printf(ctx, "queryAlbums: %d results for query: %s", counter, q)
+	metrics.RecordPayload(ctx, action.String(), metrics.DIRECTION_READ, nil,
+		size)
+	log.Debug(ctx, "Query results",
+		log.F(log.FIELD_ACTION, action.String()),
+		log.F(log.FIELD_ROWS, counter),
+		log.F(log.FIELD_QUERY, stmt.SQL))
 	return nil
 }
 
 // Queries singers by first name (has an index)
-func QuerySingersFirstName(ctx context.Context, client *spanner.Client,
-	w io.Writer) {
+func QuerySingersFirstName(ctx context.Context, client spannerdb.Client,
+	w io.Writer) error {
 	ctx, span := trace.StartSpan(ctx, "query-singers-first")
 	defer span.End()
 	q := `SELECT SingerId, FirstName, LastName FROM Singers
 				WHERE FirstName = 'Captain'`
-	err := querySingers(span, ctx, client, w, q)
+	err := querySingers(ctx, client, w, spanner.Statement{SQL: q},
+		testdata.ACTION_QUERY_SINGERS_FIRST)
 	if err != nil {
 		log.Printf(ctx, "QuerySingersFirstName Error %v", err)
+		metrics.SetSpanStatus(span, err)
 	}
+	return err
 }
 
 // Queries singers by last name (has an index)
-func QuerySingersLastName(ctx context.Context, client *spanner.Client,
-	w io.Writer) {
+func QuerySingersLastName(ctx context.Context, client spannerdb.Client,
+	w io.Writer) error {
 	ctx, span := trace.StartSpan(ctx, "query-singers-last")
 	defer span.End()
 	q := `SELECT SingerId, FirstName, LastName
 				FROM Singers@{FORCE_INDEX=SingersByLastName}
 				WHERE LastName = 'Zero'`
-	err := querySingers(span, ctx, client, w, q)
+	err := querySingers(ctx, client, w, spanner.Statement{SQL: q},
+		testdata.ACTION_QUERY_SINGERS_LAST)
 	if err != nil {
 		log.Printf(ctx, "QuerySingersLastName Error %v", err)
+		metrics.SetSpanStatus(span, err)
 	}
+	return err
 }
 
-// Execute a query with no parameters
-func querySingers(span *trace.Span, ctx context.Context,
-	client *spanner.Client, w io.Writer, q string) error {
+// Queries singers born in [start, end), oldest first (no index, a full scan)
+func QuerySingersBornBetween(ctx context.Context, client spannerdb.Client,
+	w io.Writer, start, end civil.Date) error {
+	ctx, span := trace.StartSpan(ctx, "query-singers-born")
+	defer span.End()
+	span.AddAttributes(
+		trace.StringAttribute("start", start.String()),
+		trace.StringAttribute("end", end.String()))
+	stmt := spanner.Statement{
+		SQL: `SELECT SingerId, FirstName, LastName FROM Singers
+				WHERE BirthDate >= @Start AND BirthDate < @End
+				ORDER BY BirthDate`,
+		Params: map[string]interface{}{
+			"Start": start,
+			"End":   end,
+		},
+	}
+	err := querySingers(ctx, client, w, stmt,
+		testdata.ACTION_QUERY_SINGERS_BORN)
+	if err != nil {
+		log.Printf(ctx, "QuerySingersBornBetween Error %v", err)
+		metrics.SetSpanStatus(span, err)
+	}
+	return err
+}
+
+// Queries the ten most recently added or updated singers, by the commit
+// timestamp in LastUpdated
+func QueryRecentlyUpdatedSingers(ctx context.Context,
+	client spannerdb.Client, w io.Writer) error {
+	ctx, span := trace.StartSpan(ctx, "query-recent-singers")
+	defer span.End()
+	q := `SELECT SingerId, FirstName, LastName FROM Singers
+				ORDER BY LastUpdated DESC LIMIT 10`
+	err := querySingers(ctx, client, w, spanner.Statement{SQL: q},
+		testdata.ACTION_QUERY_RECENT_SINGERS)
+	if err != nil {
+		log.Printf(ctx, "QueryRecentlyUpdatedSingers Error %v", err)
+		metrics.SetSpanStatus(span, err)
+	}
+	return err
+}
+
+// Execute a query for singers, recording the size of the results against the
+// given action
+func querySingers(ctx context.Context, client spannerdb.Client, w io.Writer,
+	stmt spanner.Statement, action testdata.Action) error {
 	ro := client.ReadOnlyTransaction()
 	defer ro.Close()
-	stmt := spanner.Statement{SQL: q}
 	iter := ro.Query(ctx, stmt)
 	defer iter.Stop()
 	counter := 0
+	var size int64
 	for {
 		row, err := iter.Next()
 		if err == iterator.Done {
@@ -142,15 +293,27 @@ func querySingers(span *trace.Span, ctx context.Context,
 		if err != nil {
 			return err
 		}
-		var singerID int64
+		singerID, err := spannerdb.ColumnKey(row, 0)
+		if err != nil {
+			return err
+		}
 		var firstName string
 		var lastName string
-		if err := row.Columns(&singerID, &firstName, &lastName); err != nil {
+		if err := row.Column(1, &firstName); err != nil {
+			return err
+		}
+		if err := row.Column(2, &lastName); err != nil {
 			return err
 		}
 		counter++
-		fmt.Fprintf(w, "%d %s %s", singerID, firstName, lastName)
+		size += int64(len(firstName) + len(lastName))
+		fmt.Fprintf(w, "%v %s %s", singerID, firstName, lastName)
 	}
-	log.Printf(ctx, "querySingers # results: %d for query: %s", counter, q)
+	metrics.RecordPayload(ctx, action.String(), metrics.DIRECTION_READ, nil,
+		size)
+	log.Debug(ctx, "Query results",
+		log.F(log.FIELD_ACTION, action.String()),
+		log.F(log.FIELD_ROWS, counter),
+		log.F(log.FIELD_QUERY, stmt.SQL))
 	return nil
 }
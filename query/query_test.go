@@ -0,0 +1,254 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"go.opencensus.io/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/GoogleCloudPlatform/opencensus-spanner-demo/internal/recorder"
+	"github.com/GoogleCloudPlatform/opencensus-spanner-demo/internal/spannerdbfake"
+	"github.com/GoogleCloudPlatform/opencensus-spanner-demo/internal/spannerfake"
+	"github.com/GoogleCloudPlatform/opencensus-spanner-demo/metrics"
+	"github.com/GoogleCloudPlatform/opencensus-spanner-demo/spannerdb"
+	"github.com/GoogleCloudPlatform/opencensus-spanner-demo/update"
+)
+
+// A fake database with two singers, one of whom has twelve albums. The
+// albums with an even number have a marketing budget growing with the number.
+func newFake() *spannerdbfake.Fake {
+	fake := spannerdbfake.New()
+	updated := time.Date(2019, time.August, 1, 12, 0, 0, 0, time.UTC)
+	fake.Insert("Singers",
+		spannerdbfake.Record{
+			"SingerId":    int64(1),
+			"FirstName":   "Captain",
+			"LastName":    "Zero",
+			"BirthDate":   civil.Date{Year: 1985, Month: time.June, Day: 15},
+			"LastUpdated": updated,
+		},
+		spannerdbfake.Record{
+			"SingerId":    int64(2),
+			"FirstName":   "Major",
+			"LastName":    "Chaos",
+			"BirthDate":   civil.Date{Year: 1962, Month: time.March, Day: 2},
+			"LastUpdated": updated.Add(time.Hour),
+		})
+	for i := 0; i < 12; i++ {
+		rec := spannerdbfake.Record{
+			"SingerId":   int64(1),
+			"AlbumId":    int64(100 + i),
+			"AlbumTitle": fmt.Sprintf("Album-%d;", i),
+		}
+		if i%2 == 0 {
+			rec["MarketingBudget"] = int64(1000 * i)
+		}
+		fake.Insert("Albums", rec)
+	}
+	return fake
+}
+
+func TestQueries(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    func(context.Context, spannerdb.Client, io.Writer) error
+		contains []string
+		excludes []string
+		albums   int
+	}{
+		{"QueryAlbums", QueryAlbums, []string{"1 100 Album-0;"}, nil, 12},
+		{"QueryAlbumsLimit", QueryAlbumsLimit, []string{"1 100 Album-0;"},
+			nil, 10},
+		{"QuerySingersFirstName", QuerySingersFirstName,
+			[]string{"1 Captain Zero"}, []string{"Major"}, 0},
+		{"QuerySingersLastName", QuerySingersLastName,
+			[]string{"1 Captain Zero"}, []string{"Chaos"}, 0},
+		{"JoinSingerAlbum", JoinSingerAlbum, []string{"1 Captain Album-11;"},
+			[]string{"Major"}, 12},
+		{"QueryTopBudgetAlbums", QueryTopBudgetAlbums,
+			[]string{"1 110 Album-10;1 108 Album-8;"}, []string{"Album-1;"},
+			6},
+		{"QueryRecentlyUpdatedSingers", QueryRecentlyUpdatedSingers,
+			[]string{"2 Major Chaos1 Captain Zero"}, nil, 0},
+		{"QuerySingersBornBetween", func(ctx context.Context,
+			client spannerdb.Client, w io.Writer) error {
+			return QuerySingersBornBetween(ctx, client, w,
+				civil.Date{Year: 1980, Month: time.January, Day: 1},
+				civil.Date{Year: 1990, Month: time.January, Day: 1})
+		}, []string{"1 Captain Zero"}, []string{"Major"}, 0},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			err := tc.query(context.Background(), newFake(), buf)
+			if err != nil {
+				t.Fatalf("%s() error = %v", tc.name, err)
+			}
+			out := buf.String()
+			for _, s := range tc.contains {
+				if !strings.Contains(out, s) {
+					t.Errorf("%s() output %q does not contain %q", tc.name,
+						out, s)
+				}
+			}
+			for _, s := range tc.excludes {
+				if strings.Contains(out, s) {
+					t.Errorf("%s() output %q contains %q", tc.name, out, s)
+				}
+			}
+			if n := strings.Count(out, "Album-"); n != tc.albums {
+				t.Errorf("%s() returned %d albums, want %d", tc.name, n,
+					tc.albums)
+			}
+		})
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		query func(context.Context, spannerdb.Client, io.Writer) error
+		err   error
+		class string
+	}{
+		{"QueryAlbums", QueryAlbums,
+			status.Error(codes.DeadlineExceeded, "deadline"),
+			update.ERROR_DEADLINE_EXCEEDED},
+		{"QuerySingersFirstName", QuerySingersFirstName,
+			status.Error(codes.PermissionDenied, "denied"),
+			update.ERROR_PERMISSION},
+		{"JoinSingerAlbum", JoinSingerAlbum,
+			status.Error(codes.Unavailable, "unavailable"),
+			update.ERROR_RETRYABLE},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := newFake()
+			fake.FailOn("SELECT", tc.err)
+			err := tc.query(context.Background(), fake, &bytes.Buffer{})
+			if class := update.Classify(err); class != tc.class {
+				t.Errorf("%s() error class = %s, want %s", tc.name, class,
+					tc.class)
+			}
+		})
+	}
+}
+
+// The spans and metrics that the README walkthrough relies on
+func TestQueryAlbumsInstrumentation(t *testing.T) {
+	ctx := context.Background()
+	srv := spannerfake.New()
+	defer srv.Close()
+	srv.AddResult("FROM Albums", []string{"SingerId", "AlbumId", "AlbumTitle"},
+		[]interface{}{int64(1), int64(100), "Album-0;"})
+	spannerClient, err := srv.Client(ctx)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer spannerClient.Close()
+	if err := view.Register(metrics.Views...); err != nil {
+		t.Fatalf("Failed to register views: %v", err)
+	}
+	defer view.Unregister(metrics.Views...)
+	rec := recorder.New()
+	defer rec.Close()
+
+	err = QueryAlbums(ctx, spannerdb.Wrap(spannerClient), &bytes.Buffer{})
+	if err != nil {
+		t.Fatalf("QueryAlbums() error = %v", err)
+	}
+	span := rec.AssertSpan(t, "query-albums")
+	rec.AssertDescendant(t, span,
+		"google.spanner.v1.Spanner.ExecuteStreamingSql")
+	recorder.AssertAttribute(t, span, "payload_bytes", int64(8))
+	recorder.AssertStatus(t, span, trace.StatusCodeOK)
+	recorder.AssertViewRow(t, "payload_size",
+		tag.Tag{Key: metrics.KeyAction, Value: "QueryAlbums"},
+		tag.Tag{Key: metrics.KeyDirection, Value: metrics.DIRECTION_READ},
+		tag.Tag{Key: metrics.KeyErrorClass, Value: update.ERROR_NONE})
+}
+
+func TestQueryErrorSpan(t *testing.T) {
+	rec := recorder.New()
+	defer rec.Close()
+	fake := newFake()
+	fake.FailOn("SELECT", status.Error(codes.DeadlineExceeded, "deadline"))
+	if err := QueryAlbums(context.Background(), fake,
+		&bytes.Buffer{}); err == nil {
+		t.Fatalf("QueryAlbums() succeeded, want error")
+	}
+	span := rec.AssertSpan(t, "query-albums")
+	recorder.AssertStatus(t, span, trace.StatusCodeDeadlineExceeded)
+	recorder.AssertAttribute(t, span, "error_class",
+		update.ERROR_DEADLINE_EXCEEDED)
+}
+
+func TestQuerySingerAlbums(t *testing.T) {
+	buf := &bytes.Buffer{}
+	err := QuerySingerAlbums(context.Background(), newFake(), buf, "Captain",
+		"Zero")
+	if err != nil {
+		t.Fatalf("QuerySingerAlbums() error = %v", err)
+	}
+	if n := strings.Count(buf.String(), "Album-"); n != 12 {
+		t.Errorf("QuerySingerAlbums() returned %d albums, want 12", n)
+	}
+	buf.Reset()
+	err = QuerySingerAlbums(context.Background(), newFake(), buf, "Major",
+		"Chaos")
+	if err != nil {
+		t.Fatalf("QuerySingerAlbums() error = %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("QuerySingerAlbums() returned %q for a singer with no albums",
+			buf.String())
+	}
+}
+
+func TestQueryAlbumCoverArt(t *testing.T) {
+	rec := recorder.New()
+	defer rec.Close()
+	fake := newFake()
+	fake.Insert("Albums", spannerdbfake.Record{
+		"SingerId":   int64(2),
+		"AlbumId":    int64(200),
+		"AlbumTitle": "Cover;",
+		"CoverArt":   make([]byte, 100),
+	})
+	buf := &bytes.Buffer{}
+	err := QueryAlbumCoverArt(context.Background(), fake, buf, "Major",
+		"Chaos")
+	if err != nil {
+		t.Fatalf("QueryAlbumCoverArt() error = %v", err)
+	}
+	if !strings.Contains(buf.String(), "2 200 Cover;") {
+		t.Errorf("QueryAlbumCoverArt() returned %q, want the album",
+			buf.String())
+	}
+	span := rec.AssertSpan(t, "query-cover-art")
+	recorder.AssertAttribute(t, span, "payload_bytes", int64(106))
+}
@@ -0,0 +1,115 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Seedable source of the random choices of a run: the actions, the generated
+// data and the keys. Running again with the same seed replays the same
+// sequence, apart from keys derived from the clock.
+package random
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// The parameters of a Zipf distribution
+type zipfParams struct {
+	s, v float64
+	imax uint64
+}
+
+var (
+	mu   sync.Mutex
+	seed int64
+	rng  *rand.Rand
+	// The generator of the last Zipf distribution drawn from, reused while
+	// the parameters stay the same
+	zipf     *rand.Zipf
+	lastZipf zipfParams
+)
+
+func init() {
+	Seed(time.Now().UnixNano())
+}
+
+// Restart the sequence from the seed
+func Seed(s int64) {
+	mu.Lock()
+	defer mu.Unlock()
+	seed = s
+	rng = rand.New(rand.NewSource(s))
+	zipf = nil
+}
+
+// The seed the current sequence started from
+func GetSeed() int64 {
+	mu.Lock()
+	defer mu.Unlock()
+	return seed
+}
+
+// A non-negative random int64
+func Int63() int64 {
+	mu.Lock()
+	defer mu.Unlock()
+	return rng.Int63()
+}
+
+// A random int in [0, n)
+func Intn(n int) int {
+	mu.Lock()
+	defer mu.Unlock()
+	return rng.Intn(n)
+}
+
+// A random int64 in [0, n)
+func Int63n(n int64) int64 {
+	mu.Lock()
+	defer mu.Unlock()
+	return rng.Int63n(n)
+}
+
+// A random float64 in [0.0, 1.0)
+func Float64() float64 {
+	mu.Lock()
+	defer mu.Unlock()
+	return rng.Float64()
+}
+
+// Fill b with random bytes
+func Read(b []byte) {
+	mu.Lock()
+	defer mu.Unlock()
+	rng.Read(b)
+}
+
+// A random value in [0, imax] with P(k) proportional to (v + k) ** -s, where
+// s > 1 and v >= 1
+func Zipf(s, v float64, imax uint64) uint64 {
+	mu.Lock()
+	defer mu.Unlock()
+	p := zipfParams{s, v, imax}
+	if zipf == nil || p != lastZipf {
+		zipf = rand.NewZipf(rng, s, v, imax)
+		lastZipf = p
+	}
+	return zipf.Uint64()
+}
+
+// A normally distributed float64 with mean 0 and standard deviation 1
+func NormFloat64() float64 {
+	mu.Lock()
+	defer mu.Unlock()
+	return rng.NormFloat64()
+}
@@ -0,0 +1,42 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdb
+
+import (
+	"os"
+
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const EMULATOR_HOST_ENV = "SPANNER_EMULATOR_HOST"
+
+// Client options to connect to the Spanner emulator at the address in
+// SPANNER_EMULATOR_HOST, or nil if it is not set. The Spanner client and the
+// admin clients apply the same options themselves when the variable is set, so
+// passing them only makes the emulator connection explicit.
+func EmulatorOptions() []option.ClientOption {
+	host := os.Getenv(EMULATOR_HOST_ENV)
+	if host == "" {
+		return nil
+	}
+	return []option.ClientOption{
+		option.WithEndpoint(host),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithTransportCredentials(
+			insecure.NewCredentials())),
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdb
+
+/**
+  Primary key values of singers and albums, which are INT64 or, with the
+  STRING(36) key schema described in the README, UUID strings.
+ **/
+
+import (
+	"cloud.google.com/go/spanner"
+	sppb "google.golang.org/genproto/googleapis/spanner/v1"
+)
+
+// A primary key value, an INT64 or, for the UUID strategy, a STRING(36)
+type Key interface{}
+
+// Read the key in column i of the row, either an INT64 or a STRING
+func ColumnKey(row *spanner.Row, i int) (Key, error) {
+	var v spanner.GenericColumnValue
+	if err := row.Column(i, &v); err != nil {
+		return nil, err
+	}
+	if v.Type.Code == sppb.TypeCode_STRING {
+		var s string
+		err := v.Decode(&s)
+		return s, err
+	}
+	var n int64
+	err := v.Decode(&n)
+	return n, err
+}
@@ -0,0 +1,111 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Narrow interfaces over the operations of the Spanner client used by the
+// query and update packages, so that they can run against the fake in
+// internal/spannerdbfake
+package spannerdb
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/spanner"
+)
+
+// Iterates over the rows of a query result, as spanner.RowIterator does
+type RowIterator interface {
+	Next() (*spanner.Row, error)
+	Stop()
+}
+
+// Runs queries, in a single use or a read-only transaction
+type Reader interface {
+	Query(ctx context.Context, stmt spanner.Statement) RowIterator
+}
+
+// A read-only transaction that must be closed after use
+type ReadOnlyTransaction interface {
+	Reader
+	Close()
+}
+
+// Runs queries and DML statements within a read-write transaction
+type ReadWriteTransaction interface {
+	Reader
+	Update(ctx context.Context, stmt spanner.Statement) (int64, error)
+}
+
+// The operations of the Spanner client used by the application
+type Client interface {
+	// Single read, in a single use transaction
+	Single() Reader
+	ReadOnlyTransaction() ReadOnlyTransaction
+	// Run the function in a read-write transaction, retrying it if the
+	// transaction is aborted
+	ReadWriteTransaction(ctx context.Context,
+		f func(context.Context, ReadWriteTransaction) error) (time.Time, error)
+}
+
+type client struct {
+	c *spanner.Client
+}
+
+// Adapt a Spanner client to the Client interface
+func Wrap(c *spanner.Client) Client {
+	return client{c}
+}
+
+func (c client) Single() Reader {
+	return reader{c.c.Single()}
+}
+
+func (c client) ReadOnlyTransaction() ReadOnlyTransaction {
+	return reader{c.c.ReadOnlyTransaction()}
+}
+
+func (c client) ReadWriteTransaction(ctx context.Context,
+	f func(context.Context, ReadWriteTransaction) error) (time.Time, error) {
+	return c.c.ReadWriteTransaction(ctx, func(ctx context.Context,
+		txn *spanner.ReadWriteTransaction) error {
+		return f(ctx, readWriter{txn})
+	})
+}
+
+type reader struct {
+	txn *spanner.ReadOnlyTransaction
+}
+
+func (r reader) Query(ctx context.Context,
+	stmt spanner.Statement) RowIterator {
+	return r.txn.Query(ctx, stmt)
+}
+
+func (r reader) Close() {
+	r.txn.Close()
+}
+
+type readWriter struct {
+	txn *spanner.ReadWriteTransaction
+}
+
+func (rw readWriter) Query(ctx context.Context,
+	stmt spanner.Statement) RowIterator {
+	return rw.txn.Query(ctx, stmt)
+}
+
+func (rw readWriter) Update(ctx context.Context,
+	stmt spanner.Statement) (int64, error) {
+	return rw.txn.Update(ctx, stmt)
+}
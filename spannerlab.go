@@ -22,6 +22,8 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"cloud.google.com/go/spanner"
 
@@ -31,7 +33,11 @@ import (
 	"go.opencensus.io/trace"
 
 	log "github.com/GoogleCloudPlatform/opencensus-spanner-demo/applog"
+	"github.com/GoogleCloudPlatform/opencensus-spanner-demo/fault"
+	"github.com/GoogleCloudPlatform/opencensus-spanner-demo/metrics"
 	"github.com/GoogleCloudPlatform/opencensus-spanner-demo/query"
+	"github.com/GoogleCloudPlatform/opencensus-spanner-demo/random"
+	"github.com/GoogleCloudPlatform/opencensus-spanner-demo/spannerdb"
 	"github.com/GoogleCloudPlatform/opencensus-spanner-demo/testdata"
 	"github.com/GoogleCloudPlatform/opencensus-spanner-demo/update"
 )
@@ -40,7 +46,7 @@ import (
 
 // Initialize OpenCensus
 // [START spannerlab_initoc]
-func initOC(project string) *stackdriver.Exporter {
+func initOC(project string, traceFraction float64) *stackdriver.Exporter {
 	se, err := stackdriver.NewExporter(stackdriver.Options{
 		ProjectID:    project,
 		MetricPrefix: "spanner-oc-test",
@@ -55,84 +61,270 @@ func initOC(project string) *stackdriver.Exporter {
 		ctx := context.Background()
 		log.Fatalf(ctx, "Failed to register gRPC default client views: %v", err)
 	}
-	trace.ApplyConfig(trace.Config{DefaultSampler: trace.AlwaysSample()})
+	if err := view.Register(metrics.Views...); err != nil {
+		ctx := context.Background()
+		log.Fatalf(ctx, "Failed to register application views: %v", err)
+	}
+	sampler := trace.AlwaysSample()
+	if traceFraction < 1 {
+		sampler = trace.ProbabilitySampler(traceFraction)
+	}
+	trace.ApplyConfig(trace.Config{DefaultSampler: sampler})
 	return se
 }
 
 // [END spannerlab_initoc]
 
+// Record the key generation strategy so that hotspotting runs can be compared
+// side by side
+func addKeyStrategy(span *trace.Span) {
+	span.AddAttributes(trace.StringAttribute("key_strategy",
+		update.GetKeyStrategy().String()))
+}
+
+// Record which of the singer and album were created, so that the two update
+// strategies can be compared for the same outcome
+func addResult(span *trace.Span, result *update.AddResult) {
+	span.AddAttributes(
+		trace.BoolAttribute("singer_created", result.SingerCreated),
+		trace.BoolAttribute("album_created", result.AlbumCreated))
+}
+
+// Record the size of the album written by an action. Nothing is recorded
+// unless the album was actually created, since failed or duplicate adds write
+// no cover art.
+func recordWrite(ctx context.Context, action testdata.Action,
+	data testdata.SingerAlbum, result *update.AddResult, err error) {
+	if err != nil || result == nil || !result.AlbumCreated {
+		return
+	}
+	size := int64(len(data.AlbumTitle) + len(data.CoverArt))
+	metrics.RecordPayload(ctx, action.String(), metrics.DIRECTION_WRITE, err,
+		size)
+}
+
 // Run the query tests
-func runQueryTest(client *spanner.Client) {
-	ctx := context.Background()
+func runQueryTest(ctx context.Context, client spannerdb.Client) {
 	buf := bytes.NewBufferString("")
 	query.QueryAlbums(ctx, client, buf)
 }
 
-// Run a simulation with a mix of queries and adds
-func runSimulation(client *spanner.Client, iterations int) {
-	fmt.Printf("Running simulation with %d iterations\n", iterations)
-	ctx := context.Background()
+// Counts of the outcomes of one kind of action in a simulation
+type actionReport struct {
+	total, failed, deadlineExceeded int
+	// Successful adds that found their singer already in the database
+	singersFound int
+}
+
+// Run a simulation with a mix of queries and adds. Each action is limited by
+// its timeout, if any, and the simulation stops early if the deadline of the
+// context passes.
+func runSimulation(ctx context.Context, client spannerdb.Client, iterations int,
+	payload testdata.PayloadSize, timeouts map[testdata.Action]time.Duration) {
+	fmt.Printf("Running simulation with %d iterations and %s access\n",
+		iterations, testdata.GetSampler())
+	reports := map[testdata.Action]*actionReport{}
+	for _, action := range testdata.ACTIONS {
+		reports[action] = &actionReport{}
+	}
 	for i := 0; i < iterations; i++ {
+		if ctx.Err() != nil {
+			fmt.Printf("Run deadline reached after %d iterations\n", i)
+			break
+		}
 		if i%10 == 0 {
 			fmt.Printf("Iteration %d\n", i)
 		}
 		action := testdata.NextUserAction()
-		log.Printf(ctx, "Next user action is %d.\n", action)
+		ctx, cancel := withActionTimeout(ctx, action, timeouts)
+		log.Debugf(ctx, "Next user action is %v", action)
 		buf := bytes.NewBufferString("")
+		start := time.Now()
+		var err error
+		var result *update.AddResult
 		switch action {
 		case testdata.ACTION_QUERY_ALBUMS:
-			query.QueryAlbums(ctx, client, buf)
+			err = query.QueryAlbums(ctx, client, buf)
 		case testdata.ACTION_QUERY_LIMIT:
-			query.QueryAlbumsLimit(ctx, client, buf)
+			err = query.QueryAlbumsLimit(ctx, client, buf)
 		case testdata.ACTION_QUERY_SINGERS_FIRST:
-			query.QuerySingersFirstName(ctx, client, buf)
+			err = query.QuerySingersFirstName(ctx, client, buf)
 		case testdata.ACTION_QUERY_SINGERS_LAST:
-			query.QuerySingersLastName(ctx, client, buf)
+			err = query.QuerySingersLastName(ctx, client, buf)
 		case testdata.ACTION_JOIN_SINGER_ALBUM:
-			query.JoinSingerAlbum(ctx, client, buf)
+			err = query.JoinSingerAlbum(ctx, client, buf)
+		case testdata.ACTION_QUERY_SINGER_ALBUMS:
+			data, ok := testdata.ExistingSingerAlbum()
+			if !ok {
+				data = testdata.RandomData()
+			}
+			err = query.QuerySingerAlbums(ctx, client, buf, data.FirstName,
+				data.LastName)
+		case testdata.ACTION_QUERY_COVER_ART:
+			data, ok := testdata.ExistingSingerAlbum()
+			if !ok {
+				data = testdata.RandomData()
+			}
+			err = query.QueryAlbumCoverArt(ctx, client, buf, data.FirstName,
+				data.LastName)
+		case testdata.ACTION_QUERY_SINGERS_BORN:
+			start, end := testdata.RandomBirthDateRange()
+			err = query.QuerySingersBornBetween(ctx, client, buf, start, end)
+		case testdata.ACTION_QUERY_TOP_BUDGET:
+			err = query.QueryTopBudgetAlbums(ctx, client, buf)
+		case testdata.ACTION_QUERY_RECENT_SINGERS:
+			err = query.QueryRecentlyUpdatedSingers(ctx, client, buf)
 		case testdata.ACTION_ADD_ALL_TXN:
-			data := testdata.RandomData()
-			ctx, span := trace.StartSpan(ctx, "add-album-single-txns")
-			_, err := update.AddAllNoTxn(ctx, client, data.FirstName, data.LastName,
-				data.AlbumTitle)
+			data := testdata.NextPayload(payload)
+			ctx, span := trace.StartSpan(ctx, "add-album-all-one-txn")
+			addKeyStrategy(span)
+			result, err = update.AddAllTxn(ctx, client, data)
 			if err != nil {
-				log.Printf(ctx, "Error adding singer %v", err)
+				log.Printf(ctx, "Error adding singer in transaction %v", err)
+				metrics.SetSpanStatus(span, err)
+			} else {
+				addResult(span, result)
+				testdata.AddExisting(data)
 			}
+			recordWrite(ctx, action, data, result, err)
 			span.End()
 		case testdata.ACTION_ADD_SINGLE_TXNS:
-			data := testdata.RandomData()
-			ctx, span := trace.StartSpan(ctx, "add-album-all-one-txn")
-			_, err := update.AddAllTxn(ctx, client, data.FirstName,
-				data.LastName, data.AlbumTitle)
+			data := testdata.NextPayload(payload)
+			ctx, span := trace.StartSpan(ctx, "add-album-single-txns")
+			addKeyStrategy(span)
+			result, err = update.AddAllNoTxn(ctx, client, data)
 			if err != nil {
-				log.Printf(ctx, "Error adding singer in transaction %v", err)
+				log.Printf(ctx, "Error adding singer %v", err)
+				metrics.SetSpanStatus(span, err)
+			} else {
+				addResult(span, result)
+				testdata.AddExisting(data)
 			}
+			recordWrite(ctx, action, data, result, err)
 			span.End()
 		}
+		latency := time.Since(start)
+		metrics.RecordAction(ctx, action.String(), err, latency)
+		log.Debug(ctx, "Action finished",
+			log.F(log.FIELD_ACTION, action.String()),
+			log.F(log.FIELD_LATENCY_MS,
+				float64(latency)/float64(time.Millisecond)),
+			log.F(log.FIELD_ERROR_CLASS, update.Classify(err)))
+		cancel()
+		report := reports[action]
+		report.total++
+		if err == nil && result != nil && !result.SingerCreated {
+			report.singersFound++
+		}
+		switch update.Classify(err) {
+		case update.ERROR_NONE, update.ERROR_NOT_FOUND:
+		case update.ERROR_DEADLINE_EXCEEDED:
+			report.deadlineExceeded++
+		default:
+			report.failed++
+		}
+	}
+	printReport(reports)
+}
+
+// Limit the context to the timeout for the action, if there is one
+func withActionTimeout(ctx context.Context, action testdata.Action,
+	timeouts map[testdata.Action]time.Duration) (context.Context,
+	context.CancelFunc) {
+	if timeout, ok := timeouts[action]; ok && timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// Parse per-action timeouts from a list like
+// QueryAlbums=500ms,AddAllInBigTransaction=2s. A default applies to the
+// actions not in the list.
+func parseTimeouts(s string,
+	def time.Duration) (map[testdata.Action]time.Duration, error) {
+	timeouts := map[testdata.Action]time.Duration{}
+	for _, action := range testdata.ACTIONS {
+		timeouts[action] = def
+	}
+	if s == "" {
+		return timeouts, nil
+	}
+	for _, entry := range strings.Split(s, ",") {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Timeout %s is not of the form ACTION=DURATION",
+				entry)
+		}
+		action, err := testdata.ParseAction(strings.TrimSpace(parts[0]))
+		if err != nil {
+			return nil, err
+		}
+		timeout, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, err
+		}
+		timeouts[action] = timeout
+	}
+	return timeouts, nil
+}
+
+// Print the outcomes of each kind of action in the simulation, counting
+// deadline exceeded apart from other failures, the share of adds that found
+// their singer and the seed to replay it
+func printReport(reports map[testdata.Action]*actionReport) {
+	fmt.Printf("Seed %d, replay with --seed=%d\n", random.GetSeed(),
+		random.GetSeed())
+	fmt.Printf("  %-28s %8s %8s %8s\n", "Action", "Total", "Failed",
+		"Deadline")
+	adds, found := 0, 0
+	for _, action := range testdata.GetActions() {
+		r := reports[action]
+		fmt.Printf("  %-28s %8d %8d %8d\n", action, r.total, r.failed,
+			r.deadlineExceeded)
+		if action == testdata.ACTION_ADD_ALL_TXN ||
+			action == testdata.ACTION_ADD_SINGLE_TXNS {
+			adds += r.total - r.failed - r.deadlineExceeded
+			found += r.singersFound
+		}
+	}
+	if adds > 0 && testdata.GetHitRatio() > 0 {
+		fmt.Printf("Existing singer hit ratio %.2f, target %.2f\n",
+			float64(found)/float64(adds), testdata.GetHitRatio())
+	} else if adds > 0 {
+		fmt.Printf("Existing singer hit ratio %.2f\n",
+			float64(found)/float64(adds))
 	}
 }
 
 // Run the update tests
-func runUpdateSmallTxns(client *spanner.Client) {
-	ctx := context.Background()
-	data := testdata.RandomData()
+func runUpdateSmallTxns(ctx context.Context, client spannerdb.Client,
+	payload testdata.PayloadSize) {
+	data := testdata.RandomPayload(payload)
 	ctx, span := trace.StartSpan(ctx, "add-album-single-txns")
-	albumId, err := update.AddAllNoTxn(ctx, client, data.FirstName,
-		data.LastName, data.AlbumTitle)
+	addKeyStrategy(span)
+	result, err := update.AddAllNoTxn(ctx, client, data)
+	recordWrite(ctx, testdata.ACTION_ADD_SINGLE_TXNS, data, result,
+		err)
 	if err != nil {
 		log.Errorf(ctx, "Error adding singer %v", err)
+		metrics.SetSpanStatus(span, err)
 	} else {
-		log.Printf(ctx, "runTest not in transaction %d", albumId)
+		addResult(span, result)
+		log.Printf(ctx, "runTest not in transaction %v, singer created: %t, "+
+			"album created: %t", result.AlbumId, result.SingerCreated,
+			result.AlbumCreated)
 	}
-	sNum, err := update.CountRows(client, "SingerId", "Singers")
+	sNum, err := update.CountRows(ctx, client, "SingerId", "Singers")
 	if err != nil {
 		log.Errorf(ctx, "Error querying singers %v", err)
+		metrics.SetSpanStatus(span, err)
 	} else {
 		log.Printf(ctx, "Total number of singers %d", sNum)
 	}
-	aNum, err := update.CountRows(client, "AlbumId", "Albums")
+	aNum, err := update.CountRows(ctx, client, "AlbumId", "Albums")
 	if err != nil {
-		log.Errorf(ctx, "Error querying singers %v", err)
+		log.Errorf(ctx, "Error querying albums %v", err)
+		metrics.SetSpanStatus(span, err)
 	} else {
 		log.Printf(ctx, "Total number of albums %d", aNum)
 	}
@@ -140,26 +332,33 @@ func runUpdateSmallTxns(client *spanner.Client) {
 }
 
 // Run the update tests
-func runUpdateBigTxn(client *spanner.Client) {
-	ctx := context.Background()
-	data := testdata.RandomData()
+func runUpdateBigTxn(ctx context.Context, client spannerdb.Client,
+	payload testdata.PayloadSize) {
+	data := testdata.RandomPayload(payload)
 	ctx, span := trace.StartSpan(ctx, "add-album-all-one-txn")
-	albumId, err := update.AddAllTxn(ctx, client, data.FirstName,
-		data.LastName, data.AlbumTitle)
+	addKeyStrategy(span)
+	result, err := update.AddAllTxn(ctx, client, data)
+	recordWrite(ctx, testdata.ACTION_ADD_ALL_TXN, data, result, err)
 	if err != nil {
 		log.Printf(ctx, "Error adding singer in transaction %v", err)
+		metrics.SetSpanStatus(span, err)
 	} else {
-		log.Printf(ctx, "runTest in transaction %d", albumId)
+		addResult(span, result)
+		log.Printf(ctx, "runTest in transaction %v, singer created: %t, "+
+			"album created: %t", result.AlbumId, result.SingerCreated,
+			result.AlbumCreated)
 	}
-	sNum, err := update.CountRows(client, "SingerId", "Singers")
+	sNum, err := update.CountRows(ctx, client, "SingerId", "Singers")
 	if err != nil {
 		log.Printf(ctx, "Error querying singers %v", err)
+		metrics.SetSpanStatus(span, err)
 	} else {
 		log.Printf(ctx, "Total number of singers %d", sNum)
 	}
-	aNum, err := update.CountRows(client, "AlbumId", "Albums")
+	aNum, err := update.CountRows(ctx, client, "AlbumId", "Albums")
 	if err != nil {
-		log.Printf(ctx, "Error querying singers %v", err)
+		log.Printf(ctx, "Error querying albums %v", err)
+		metrics.SetSpanStatus(span, err)
 	} else {
 		log.Printf(ctx, "Total number of albums %d", aNum)
 	}
@@ -168,6 +367,12 @@ func runUpdateBigTxn(client *spanner.Client) {
 
 // Entry point for the application
 func main() {
+	os.Exit(run())
+}
+
+// Run the command given by the flags and return the exit code. The deferred
+// calls flush the logs and telemetry before main exits.
+func run() int {
 	project := os.Getenv("GOOGLE_CLOUD_PROJECT")
 	var projPtr = flag.String("project", project, "The project id")
 	var instance = flag.String("instance", "test-instance",
@@ -177,6 +382,44 @@ func main() {
 		"One of [update_big_txn | update_small_txns | query_test | simulation]")
 	var iterations = flag.Int("iterations", 100,
 		"Number of iterations to run for the 'simulation' command")
+	var keys = flag.String("keys", "random",
+		"Primary key strategy, one of [random | sequential | bit_reversed | uuid]")
+	var titleSize = flag.Int("title-size", 0,
+		"Maximum size in bytes of generated album titles, 0 for short titles")
+	var coverArtSize = flag.Int("cover-art-size", 0,
+		"Maximum size in bytes of generated album cover art, 0 for none")
+	var timeout = flag.Duration("timeout", 0,
+		"Default timeout for each action, 0 for none")
+	var actionTimeouts = flag.String("action-timeouts", "",
+		"Timeouts for specific actions, e.g. QueryAlbums=500ms,QueryLimit=100ms")
+	var runTimeout = flag.Duration("run-timeout", 0,
+		"Deadline for the whole run, 0 for none")
+	var faults = flag.String("faults", "",
+		"Faults to inject into Spanner RPCs, e.g. Commit:aborted@0.2")
+	var seed = flag.Int64("seed", 0,
+		"Seed for the actions, data and keys of the run, 0 for a random seed")
+	var dictionary = flag.String("dictionary", "",
+		"Directory of word lists for generated names, empty for the built in")
+	var uniqueNames = flag.Bool("unique-names", false,
+		"Make every generated singer name unique")
+	var hitRatio = flag.Float64("hit-ratio", testdata.DEFAULT_HIT_RATIO,
+		"Share of adds for a singer added earlier in the run, 0 for chance "+
+			"collisions only")
+	var logSink = flag.String("log-sink", log.SINK_CLOUD,
+		"Where to send logs, one of [cloud | json | json:PATH | std | none]")
+	var logLevel = flag.String("log-level", "info",
+		"Minimum severity logged with package overrides, e.g. warning,update=debug")
+	var logSampling = flag.String("log-sampling", log.SAMPLING_ALL,
+		"Logs of unsampled traces, one of [all | errors | RATE]")
+	var traceFraction = flag.Float64("trace-fraction", 1,
+		"Share of the traces that are sampled")
+	var telemetry = flag.String("telemetry", TELEMETRY_OPENCENSUS,
+		"Library to export spans and metrics with, one of [opencensus | otel]")
+	var actions = flag.String("actions", testdata.ACTIONS_DEFAULT,
+		"Actions of the simulation, one of [default | all | ACTION,...]")
+	var access = flag.String("access", testdata.SAMPLER_UNIFORM,
+		"Distribution of reads and updates of existing singers, one of "+
+			"[uniform | zipf[:S] | hotspot[:TRAFFIC:KEYS] | latest[:S]]")
 
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr,
@@ -184,46 +427,174 @@ func main() {
   --instance=$SPANNER_INSTANCE \
   --database=$DATABASE \
   --command=COMMAND \
-  [--iterations=iterations]
+  [--iterations=iterations] \
+  [--keys=KEY_STRATEGY] \
+  [--title-size=BYTES] \
+  [--cover-art-size=BYTES] \
+  [--timeout=DURATION] \
+  [--action-timeouts=ACTION=DURATION,...] \
+  [--run-timeout=DURATION] \
+  [--faults=METHOD:FAULT[=DURATION]@RATE,...] \
+  [--seed=SEED] \
+  [--actions=default|all|ACTION,...] \
+  [--access=DISTRIBUTION] \
+  [--dictionary=DIR] \
+  [--unique-names] \
+  [--hit-ratio=RATIO] \
+  [--log-sink=SINK] \
+  [--log-level=LEVEL[,PACKAGE=LEVEL,...]] \
+  [--log-sampling=all|errors|RATE] \
+  [--trace-fraction=FRACTION] \
+  [--telemetry=opencensus|otel]
 `)
 	}
 	flag.Parse()
 	if *projPtr == "" {
 		fmt.Println("project flag must have a value")
 		flag.Usage()
-		os.Exit(2)
+		return 2
+	}
+	keyStrategy, err := update.ParseKeyStrategy(*keys)
+	if err != nil {
+		fmt.Println(err)
+		flag.Usage()
+		return 2
+	}
+	update.SetKeyStrategy(keyStrategy)
+	payload := testdata.PayloadSize{
+		TitleBytes:    *titleSize,
+		CoverArtBytes: *coverArtSize,
+	}
+	timeouts, err := parseTimeouts(*actionTimeouts, *timeout)
+	if err != nil {
+		fmt.Println(err)
+		flag.Usage()
+		return 2
+	}
+	simActions, err := testdata.ParseActions(*actions)
+	if err == nil {
+		err = testdata.SetActions(simActions)
+	}
+	if err != nil {
+		fmt.Println(err)
+		flag.Usage()
+		return 2
+	}
+	sampler, err := testdata.ParseSampler(*access)
+	if err != nil {
+		fmt.Println(err)
+		flag.Usage()
+		return 2
+	}
+	testdata.SetSampler(sampler)
+	if *dictionary != "" {
+		d, err := testdata.LoadDictionary(*dictionary)
+		if err != nil {
+			fmt.Println(err)
+			return 2
+		}
+		testdata.SetDictionary(d)
+	}
+	testdata.SetUniqueNames(*uniqueNames)
+	if err := testdata.SetHitRatio(*hitRatio); err != nil {
+		fmt.Println(err)
+		flag.Usage()
+		return 2
+	}
+	if *seed != 0 {
+		random.Seed(*seed)
+	}
+	fmt.Printf("Seed %d, replay with --seed=%d\n", random.GetSeed(),
+		random.GetSeed())
+	injector, err := fault.Parse(*faults)
+	if err != nil {
+		fmt.Println(err)
+		flag.Usage()
+		return 2
 	}
 
-	log.Initialize(project)
-	defer log.Close()
+	logger, err := log.Open(*logSink, project)
+	if err != nil && *logSink == log.SINK_CLOUD {
+		fmt.Printf("Failed to create logging client: %v\n", err)
+		logger, err = log.New(log.NewStdSink(), project), nil
+	} else if err == nil && *logSink == log.SINK_CLOUD {
+		fmt.Printf("Stackdriver Logging initialized with project id %s, see "+
+			"Cloud Console under GCE VM instance > all instance_id\n", project)
+	}
+	if err != nil {
+		fmt.Println(err)
+		flag.Usage()
+		return 2
+	}
+	defer logger.Close()
+	if err := logger.SetLevels(*logLevel); err != nil {
+		fmt.Println(err)
+		flag.Usage()
+		return 2
+	}
+	unsampledRate, err := log.ParseSampling(*logSampling)
+	if err != nil {
+		fmt.Println(err)
+		flag.Usage()
+		return 2
+	}
+	logger.SetUnsampledRate(unsampledRate)
+	if *traceFraction < 0 || *traceFraction > 1 {
+		fmt.Println("trace-fraction must be between 0 and 1")
+		flag.Usage()
+		return 2
+	}
+	log.SetDefault(logger)
 
 	databaseName := fmt.Sprintf("projects/%s/instances/%s/databases/%s", *projPtr,
 		*instance, *db)
 
-	// Initialize OpenCensus
-	se := initOC(project)
-	defer se.Flush()
+	// Initialize OpenCensus, or OpenTelemetry with the OpenCensus bridge
+	flush, err := initTelemetry(*telemetry, project, *traceFraction)
+	if err != nil {
+		fmt.Println(err)
+		flag.Usage()
+		return 2
+	}
+	defer flush()
 
 	// Initialize Spanner client
-	ctx := context.Background()
-	client, err := spanner.NewClient(ctx, databaseName)
+	ctx := log.NewContext(context.Background(), logger)
+	opts := append(spannerdb.EmulatorOptions(), injector.ClientOptions()...)
+	spannerClient, err := spanner.NewClient(ctx, databaseName, opts...)
 	if err != nil {
 		fmt.Printf("Failed to create Spanner client %v", err)
-		os.Exit(1)
+		return 1
 	}
-	defer client.Close()
+	defer spannerClient.Close()
+	client := spannerdb.Wrap(spannerClient)
 
+	if *runTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *runTimeout)
+		defer cancel()
+	}
 	if *command == "update_big_txn" {
-		runUpdateBigTxn(client)
+		ctx, cancel := withActionTimeout(ctx, testdata.ACTION_ADD_ALL_TXN,
+			timeouts)
+		defer cancel()
+		runUpdateBigTxn(ctx, client, payload)
 	} else if *command == "update_small_txns" {
-		runUpdateSmallTxns(client)
+		ctx, cancel := withActionTimeout(ctx, testdata.ACTION_ADD_SINGLE_TXNS,
+			timeouts)
+		defer cancel()
+		runUpdateSmallTxns(ctx, client, payload)
 	} else if *command == "query_test" {
-		runQueryTest(client)
+		ctx, cancel := withActionTimeout(ctx, testdata.ACTION_QUERY_ALBUMS,
+			timeouts)
+		defer cancel()
+		runQueryTest(ctx, client)
 	} else if *command == "simulation" {
-		runSimulation(client, *iterations)
+		runSimulation(ctx, client, *iterations, payload, timeouts)
 	} else {
-		fmt.Printf("Command %s not understood", command)
+		fmt.Printf("Command %s not understood", *command)
 		flag.Usage()
-		os.Exit(2)
+		return 2
 	}
+	return 0
 }
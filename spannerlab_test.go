@@ -0,0 +1,103 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/opencensus-spanner-demo/testdata"
+)
+
+func TestParseTimeouts(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		def     time.Duration
+		want    map[testdata.Action]time.Duration
+		wantErr bool
+	}{
+		{
+			name: "default only",
+			def:  time.Second,
+			want: map[testdata.Action]time.Duration{
+				testdata.ACTION_QUERY_ALBUMS: time.Second,
+				testdata.ACTION_ADD_ALL_TXN:  time.Second,
+			},
+		},
+		{
+			name: "override over default",
+			spec: "QueryAlbums=250ms, AddAllInBigTransaction = 2s",
+			def:  time.Second,
+			want: map[testdata.Action]time.Duration{
+				testdata.ACTION_QUERY_ALBUMS:    250 * time.Millisecond,
+				testdata.ACTION_ADD_ALL_TXN:     2 * time.Second,
+				testdata.ACTION_ADD_SINGLE_TXNS: time.Second,
+			},
+		},
+		{
+			name: "override without default",
+			spec: "QueryLimit=100ms",
+			want: map[testdata.Action]time.Duration{
+				testdata.ACTION_QUERY_LIMIT:  100 * time.Millisecond,
+				testdata.ACTION_QUERY_ALBUMS: 0,
+			},
+		},
+		{name: "bad action", spec: "QueryNothing=1s", wantErr: true},
+		{name: "bad duration", spec: "QueryAlbums=soon", wantErr: true},
+		{name: "missing duration", spec: "QueryAlbums", wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseTimeouts(tc.spec, tc.def)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("parseTimeouts(%q) = %v, want error", tc.spec,
+						got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseTimeouts(%q): %v", tc.spec, err)
+			}
+			for action, want := range tc.want {
+				if got[action] != want {
+					t.Errorf("parseTimeouts(%q)[%v] = %v, want %v", tc.spec,
+						action, got[action], want)
+				}
+			}
+		})
+	}
+}
+
+func TestWithActionTimeout(t *testing.T) {
+	timeouts := map[testdata.Action]time.Duration{
+		testdata.ACTION_QUERY_ALBUMS: time.Minute,
+		testdata.ACTION_QUERY_LIMIT:  0,
+	}
+	ctx, cancel := withActionTimeout(context.Background(),
+		testdata.ACTION_QUERY_ALBUMS, timeouts)
+	defer cancel()
+	if _, ok := ctx.Deadline(); !ok {
+		t.Errorf("QueryAlbums context has no deadline")
+	}
+	ctx, cancel = withActionTimeout(context.Background(),
+		testdata.ACTION_QUERY_LIMIT, timeouts)
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Errorf("QueryLimit context has a deadline with a zero timeout")
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+/**
+  Choice of the telemetry library the spans and views are exported with. The
+  app and the Spanner client are instrumented with OpenCensus either way. In
+  OpenTelemetry mode the OpenCensus bridge hands the spans and views to the
+  OpenTelemetry SDK, which exports them over OTLP, so the Spanner client's
+  spans stay children of the app's spans.
+ **/
+
+import (
+	"context"
+	"fmt"
+)
+
+// Values of the --telemetry flag
+const (
+	TELEMETRY_OPENCENSUS = "opencensus"
+	TELEMETRY_OTEL       = "otel"
+)
+
+// Name of the service in the OpenTelemetry resource
+const SERVICE_NAME = "oc-spannerlab"
+
+// Set up the exporters of the telemetry mode and return a function that
+// flushes them
+func initTelemetry(mode, project string, traceFraction float64) (func(),
+	error) {
+	switch mode {
+	case TELEMETRY_OPENCENSUS:
+		se := initOC(project, traceFraction)
+		return se.Flush, nil
+	case TELEMETRY_OTEL:
+		shutdown, err := initOTel(context.Background(), traceFraction)
+		if err != nil {
+			return nil, err
+		}
+		return func() {
+			if err := shutdown(context.Background()); err != nil {
+				fmt.Printf("Failed to flush telemetry: %v\n", err)
+			}
+		}, nil
+	}
+	return nil, fmt.Errorf("Unknown telemetry %s, expected one of "+
+		"[opencensus | otel]", mode)
+}
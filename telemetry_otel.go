@@ -0,0 +1,103 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+/**
+  OpenTelemetry SDK with OTLP exporters. The OTLP endpoint and its options
+  are read from the standard OTEL_EXPORTER_OTLP_* environment variables.
+ **/
+
+import (
+	"context"
+
+	"go.opencensus.io/plugin/ocgrpc"
+	"go.opencensus.io/stats/view"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/bridge/opencensus"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	log "github.com/GoogleCloudPlatform/opencensus-spanner-demo/applog"
+	"github.com/GoogleCloudPlatform/opencensus-spanner-demo/metrics"
+)
+
+// Export the OpenCensus spans and views of the app and the Spanner client
+// through the OpenTelemetry SDK, with a share of the traces sampled, and
+// return a function that flushes and stops it
+func initOTel(ctx context.Context,
+	traceFraction float64) (func(context.Context) error, error) {
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", SERVICE_NAME)))
+	if err != nil {
+		return nil, err
+	}
+
+	traceExporter, err := otlptracegrpc.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(traceExporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(
+			sdktrace.TraceIDRatioBased(traceFraction))))
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	// Spans started with the OpenCensus API, by the app and by the Spanner
+	// client, become OpenTelemetry spans in the same trace
+	opencensus.InstallTraceBridge()
+	// Correlate logs with spans started with the OpenTelemetry API too
+	log.RegisterSpanContextExtractor(otelSpanContext)
+
+	if err := view.Register(ocgrpc.DefaultClientViews...); err != nil {
+		return nil, err
+	}
+	if err := view.Register(metrics.Views...); err != nil {
+		return nil, err
+	}
+	metricExporter, err := otlpmetricgrpc.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// The views of the app keep their names and are read from OpenCensus
+	reader := sdkmetric.NewPeriodicReader(metricExporter,
+		sdkmetric.WithProducer(opencensus.NewMetricProducer()))
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader),
+		sdkmetric.WithResource(res))
+	otel.SetMeterProvider(mp)
+
+	return func(ctx context.Context) error {
+		err := tp.Shutdown(ctx)
+		if mErr := mp.Shutdown(ctx); err == nil {
+			err = mErr
+		}
+		return err
+	}, nil
+}
+
+func otelSpanContext(ctx context.Context) (log.SpanContext, bool) {
+	sc := oteltrace.SpanContextFromContext(ctx)
+	return log.SpanContext{
+		TraceID: sc.TraceID().String(),
+		SpanID:  sc.SpanID().String(),
+		Sampled: sc.IsSampled(),
+	}, sc.IsValid()
+}
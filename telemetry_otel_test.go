@@ -0,0 +1,61 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"go.opencensus.io/trace"
+
+	log "github.com/GoogleCloudPlatform/opencensus-spanner-demo/applog"
+)
+
+// Spans started with the OpenCensus API are sampled by the SDK with the trace
+// fraction and correlated with the logs
+func TestOTelSampling(t *testing.T) {
+	// Nothing listens there, the spans are dropped on shutdown
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://127.0.0.1:1")
+	tests := []struct {
+		fraction float64
+		sampled  bool
+	}{
+		{1, true},
+		{0, false},
+	}
+	for _, tc := range tests {
+		shutdown, err := initOTel(context.Background(), tc.fraction)
+		if err != nil {
+			t.Fatalf("initOTel(%g): %v", tc.fraction, err)
+		}
+		ctx, span := trace.StartSpan(context.Background(), "test")
+		sc, ok := otelSpanContext(ctx)
+		if !ok {
+			t.Errorf("No OpenTelemetry span in the context of an OpenCensus "+
+				"span with fraction %g", tc.fraction)
+		}
+		if sc.Sampled != tc.sampled {
+			t.Errorf("Span sampled = %t with fraction %g, want %t",
+				sc.Sampled, tc.fraction, tc.sampled)
+		}
+		if got, _ := log.SpanContextFromContext(ctx); got != sc {
+			t.Errorf("Log span context = %+v, want %+v", got, sc)
+		}
+		span.End()
+		cancelled, cancel := context.WithCancel(context.Background())
+		cancel()
+		shutdown(cancelled)
+	}
+}
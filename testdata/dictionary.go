@@ -0,0 +1,200 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testdata
+
+/**
+  Word lists that generated names are made of. A first name is a rank and an
+  initial, a last name a surname and a generation and an album title is
+  "<title first> on the <title second>". The lists can be loaded from files
+  to change the number of distinct names, and names can be made unique so
+  that whether an add finds an existing singer is decided by the hit ratio
+  alone, not by chance collisions.
+ **/
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/GoogleCloudPlatform/opencensus-spanner-demo/random"
+)
+
+// Names of the dictionary files, one entry per line
+const (
+	DICT_RANK         = "rank.txt"
+	DICT_INITIAL      = "initial.txt"
+	DICT_SURNAME      = "surname.txt"
+	DICT_GENERATION   = "generation.txt"
+	DICT_TITLE_FIRST  = "title_first.txt"
+	DICT_TITLE_SECOND = "title_second.txt"
+)
+
+// Share of adds for an existing singer unless set. None are chosen on purpose,
+// so an add only finds its singer if a random name collides with an earlier
+// one.
+const DEFAULT_HIT_RATIO = 0.0
+
+type Dictionary struct {
+	Rank, Initial, Surname, Generation []string
+	TitleFirst, TitleSecond            []string
+}
+
+// The number of distinct singer names the dictionary can make
+func (d *Dictionary) Singers() int64 {
+	return int64(len(d.Rank)) * int64(len(d.Initial)) *
+		int64(len(d.Surname)) * int64(len(d.Generation))
+}
+
+func DefaultDictionary() *Dictionary {
+	return &Dictionary{
+		Rank: []string{"Private", "Brigadier", "Sergeant", "Captain",
+			"Commander", "Chief", "Lieutenant", "Officer", "First Officer",
+			"Major", "General", "Five Star General", "Admiral",
+			"Rear Admiral", "Vice General"},
+		Initial: []string{"A", "B", "C", "D", "E", "F", "G", "H", "I", "J",
+			"K", "L", "M", "N", "O", "P", "Q", "R", "S", "T", "U", "V", "W",
+			"X", "Y", "Z"},
+		Surname: []string{"Ryan", "General", "Major", "Zero", "Supreme",
+			"Petty officer", "Governor", "In Charge", "Blunder", "Chaos"},
+		Generation: []string{"Junior", "II", "III", "IV", "V", "VI", "VII",
+			"VIII", "IX", "X", "XI", "XII", "XIII", "XIV", "XV", "XVI",
+			"XVII", "XVIII", "XIX", "XX"},
+		TitleFirst: []string{"Smoke", "Mist", "Rain", "Fog", "Thunder",
+			"Lightening", "Frost", "Dew", "Snow", "Shadows", "Water", "Grass",
+			"Trees", "Dust", "Wind", "Breeze", "Trash", "Graffiti",
+			"Writing"},
+		TitleSecond: []string{"Water", "River", "Plains", "Road", "Mountain",
+			"Hills", "Sea", "Bay", "Forest", "Highway", "Wall", "Blackboard"},
+	}
+}
+
+// Load a dictionary from the files in a directory. Blank lines and lines
+// starting with # are skipped. A missing file keeps the default words.
+func LoadDictionary(dir string) (*Dictionary, error) {
+	d := DefaultDictionary()
+	lists := map[string]*[]string{
+		DICT_RANK:         &d.Rank,
+		DICT_INITIAL:      &d.Initial,
+		DICT_SURNAME:      &d.Surname,
+		DICT_GENERATION:   &d.Generation,
+		DICT_TITLE_FIRST:  &d.TitleFirst,
+		DICT_TITLE_SECOND: &d.TitleSecond,
+	}
+	for name, list := range lists {
+		words, err := readWords(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(words) == 0 {
+			return nil, fmt.Errorf("Dictionary file %s has no words",
+				filepath.Join(dir, name))
+		}
+		*list = words
+	}
+	return d, nil
+}
+
+func readWords(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var words []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			words = append(words, line)
+		}
+	}
+	return words, scanner.Err()
+}
+
+var (
+	dictionary  = DefaultDictionary()
+	uniqueNames bool
+	nameSeq     int64
+	hitRatio    = DEFAULT_HIT_RATIO
+	// Guards the variables above
+	dictMu sync.Mutex
+)
+
+// The words generated names are made of
+func GetDictionary() *Dictionary {
+	dictMu.Lock()
+	defer dictMu.Unlock()
+	return dictionary
+}
+
+func SetDictionary(d *Dictionary) {
+	dictMu.Lock()
+	defer dictMu.Unlock()
+	dictionary = d
+}
+
+// Whether generated last names carry a suffix that makes every singer unique
+func GetUniqueNames() bool {
+	dictMu.Lock()
+	defer dictMu.Unlock()
+	return uniqueNames
+}
+
+func SetUniqueNames(unique bool) {
+	dictMu.Lock()
+	defer dictMu.Unlock()
+	uniqueNames = unique
+}
+
+// The share of adds that are for a singer added earlier in the run
+func GetHitRatio() float64 {
+	dictMu.Lock()
+	defer dictMu.Unlock()
+	return hitRatio
+}
+
+// Set the share of adds that are for a singer added earlier in the run. With
+// unique names the other adds never find their singer, so the share of adds
+// that find an existing singer is the ratio.
+func SetHitRatio(r float64) error {
+	if r < 0 || r > 1 {
+		return fmt.Errorf("Hit ratio %g is not between 0 and 1", r)
+	}
+	dictMu.Lock()
+	defer dictMu.Unlock()
+	hitRatio = r
+	return nil
+}
+
+// The suffix of the next unique last name, or empty without unique names.
+// The suffix starts with the seed of the run, which tells the names of runs
+// with different seeds apart and gives a replayed run the same names.
+func nextNameSuffix() string {
+	dictMu.Lock()
+	defer dictMu.Unlock()
+	if !uniqueNames {
+		return ""
+	}
+	nameSeq++
+	return fmt.Sprintf(" %s-%d", strconv.FormatInt(random.GetSeed(), 36),
+		nameSeq)
+}
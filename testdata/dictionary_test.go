@@ -0,0 +1,121 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testdata
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/opencensus-spanner-demo/random"
+)
+
+func TestLoadDictionary(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dictionary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	err = ioutil.WriteFile(filepath.Join(dir, DICT_SURNAME),
+		[]byte("# Surnames\nNova\n\n  Quasar  \n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := LoadDictionary(dir)
+	if err != nil {
+		t.Fatalf("LoadDictionary() error = %v", err)
+	}
+	if strings.Join(d.Surname, ",") != "Nova,Quasar" {
+		t.Errorf("Surnames = %v, want [Nova Quasar]", d.Surname)
+	}
+	if len(d.Rank) != len(DefaultDictionary().Rank) {
+		t.Errorf("Ranks = %v, want the default", d.Rank)
+	}
+	if want := int64(15 * 26 * 2 * 20); d.Singers() != want {
+		t.Errorf("Singers() = %d, want %d", d.Singers(), want)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(dir, DICT_RANK), []byte("# none\n"),
+		0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadDictionary(dir); err == nil {
+		t.Errorf("LoadDictionary() with an empty file succeeded")
+	}
+}
+
+func TestUniqueNames(t *testing.T) {
+	SetDictionary(&Dictionary{
+		Rank:        []string{"Captain"},
+		Initial:     []string{"A"},
+		Surname:     []string{"Zero"},
+		Generation:  []string{"II"},
+		TitleFirst:  []string{"Rain"},
+		TitleSecond: []string{"Road"},
+	})
+	defer SetDictionary(DefaultDictionary())
+	SetUniqueNames(true)
+	defer SetUniqueNames(false)
+	names := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		data := RandomData()
+		name := data.FirstName + " " + data.LastName
+		if names[name] {
+			t.Fatalf("Duplicate singer %s", name)
+		}
+		names[name] = true
+	}
+
+	// The names carry the seed, so a replayed run makes the same names
+	random.Seed(5)
+	if data := RandomData(); !strings.Contains(data.LastName, " 5-") {
+		t.Errorf("Unique name %s does not carry the seed 5", data.LastName)
+	}
+}
+
+func TestHitRatio(t *testing.T) {
+	random.Seed(1)
+	ResetExisting()
+	defer ResetExisting()
+	SetUniqueNames(true)
+	defer SetUniqueNames(false)
+	if err := SetHitRatio(0.2); err != nil {
+		t.Fatal(err)
+	}
+	defer SetHitRatio(DEFAULT_HIT_RATIO)
+	if err := SetHitRatio(1.5); err == nil {
+		t.Errorf("SetHitRatio(1.5) succeeded")
+	}
+
+	// Simulate adds, remembering the singers as the simulation does
+	seen := map[string]bool{}
+	hits := 0
+	const ADDS = 2000
+	for i := 0; i < ADDS; i++ {
+		data := NextPayload(PayloadSize{})
+		name := data.FirstName + " " + data.LastName
+		if seen[name] {
+			hits++
+		}
+		seen[name] = true
+		AddExisting(data)
+	}
+	if ratio := float64(hits) / ADDS; ratio < 0.17 || ratio > 0.23 {
+		t.Errorf("Hit ratio %.3f, want about 0.2", ratio)
+	}
+}
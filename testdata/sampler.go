@@ -0,0 +1,273 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testdata
+
+/**
+  Key access distributions for reads and updates of existing singers and
+  albums. The last singers added during a run are remembered in the order
+  they were added and a sampler chooses among them. Real workloads are
+  rarely uniform, a few hot keys or the most recent rows usually get most of
+  the traffic, which concentrates load on a few splits.
+ **/
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/GoogleCloudPlatform/opencensus-spanner-demo/random"
+)
+
+const (
+	SAMPLER_UNIFORM = "uniform"
+	SAMPLER_ZIPF    = "zipf"
+	SAMPLER_HOTSPOT = "hotspot"
+	SAMPLER_LATEST  = "latest"
+)
+
+const (
+	// Skew of the Zipfian and latest samplers unless given, must be > 1
+	DEFAULT_ZIPF_S = 1.1
+	// Share of traffic to share of keys of the hotspot sampler unless given
+	DEFAULT_HOT_TRAFFIC = 0.9
+	DEFAULT_HOT_KEYS    = 0.1
+	// Number of singers and albums remembered for later reads and updates
+	MAX_EXISTING = 100000
+)
+
+// Chooses one of n items, numbered in the order they were added
+type Sampler interface {
+	Sample(n int) int
+	String() string
+}
+
+// Every item equally likely
+type uniformSampler struct{}
+
+func (uniformSampler) Sample(n int) int {
+	return random.Intn(n)
+}
+
+func (uniformSampler) String() string {
+	return SAMPLER_UNIFORM
+}
+
+// The probability of the item of rank k is proportional to 1/k^s, the first
+// items added are the hottest
+type zipfSampler struct {
+	s float64
+}
+
+func (z zipfSampler) Sample(n int) int {
+	if n == 1 {
+		return 0
+	}
+	return int(random.Zipf(z.s, 1, uint64(n-1)))
+}
+
+func (z zipfSampler) String() string {
+	return fmt.Sprintf("%s:%g", SAMPLER_ZIPF, z.s)
+}
+
+// A share of the traffic goes to a share of the items, the first items
+// added, and the rest of the traffic to the rest of the items
+type hotspotSampler struct {
+	traffic, keys float64
+}
+
+func (h hotspotSampler) Sample(n int) int {
+	hot := int(math.Ceil(h.keys * float64(n)))
+	if hot >= n || random.Float64() < h.traffic {
+		return random.Intn(hot)
+	}
+	return hot + random.Intn(n-hot)
+}
+
+func (h hotspotSampler) String() string {
+	return fmt.Sprintf("%s:%g:%g", SAMPLER_HOTSPOT, h.traffic, h.keys)
+}
+
+// Zipfian with the most recently added items the hottest
+type latestSampler struct {
+	zipfSampler
+}
+
+func (l latestSampler) Sample(n int) int {
+	return n - 1 - l.zipfSampler.Sample(n)
+}
+
+func (l latestSampler) String() string {
+	return fmt.Sprintf("%s:%g", SAMPLER_LATEST, l.s)
+}
+
+func NewUniformSampler() Sampler {
+	return uniformSampler{}
+}
+
+func NewZipfSampler(s float64) Sampler {
+	return zipfSampler{s}
+}
+
+// Send the traffic share of the accesses to the keys share of the items
+func NewHotspotSampler(traffic, keys float64) Sampler {
+	return hotspotSampler{traffic, keys}
+}
+
+func NewLatestSampler(s float64) Sampler {
+	return latestSampler{zipfSampler{s}}
+}
+
+// Parse a sampler from uniform, zipf[:S], hotspot[:TRAFFIC:KEYS] or
+// latest[:S], for example hotspot:0.8:0.2 sends 80% of the traffic to 20%
+// of the keys
+func ParseSampler(spec string) (Sampler, error) {
+	parts := strings.Split(spec, ":")
+	var params []float64
+	for _, p := range parts[1:] {
+		f, err := strconv.ParseFloat(p, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Bad parameter %s in sampler %s", p, spec)
+		}
+		params = append(params, f)
+	}
+	skew := func() (float64, error) {
+		if len(params) == 0 {
+			return DEFAULT_ZIPF_S, nil
+		}
+		if len(params) != 1 || params[0] <= 1 {
+			return 0, fmt.Errorf("Sampler %s needs one skew above 1", spec)
+		}
+		return params[0], nil
+	}
+	switch parts[0] {
+	case SAMPLER_UNIFORM:
+		if len(params) != 0 {
+			return nil, fmt.Errorf("Sampler %s takes no parameters", spec)
+		}
+		return NewUniformSampler(), nil
+	case SAMPLER_ZIPF:
+		s, err := skew()
+		if err != nil {
+			return nil, err
+		}
+		return NewZipfSampler(s), nil
+	case SAMPLER_LATEST:
+		s, err := skew()
+		if err != nil {
+			return nil, err
+		}
+		return NewLatestSampler(s), nil
+	case SAMPLER_HOTSPOT:
+		if len(params) == 0 {
+			params = []float64{DEFAULT_HOT_TRAFFIC, DEFAULT_HOT_KEYS}
+		}
+		if len(params) != 2 || params[0] < 0 || params[0] > 1 ||
+			params[1] <= 0 || params[1] > 1 {
+			return nil, fmt.Errorf("Sampler %s needs a traffic share and a "+
+				"key share between 0 and 1", spec)
+		}
+		return NewHotspotSampler(params[0], params[1]), nil
+	}
+	return nil, fmt.Errorf("Unknown sampler %s, expected one of "+
+		"[uniform | zipf | hotspot | latest]", spec)
+}
+
+var (
+	sampler Sampler = uniformSampler{}
+	// Ring buffer of the last MAX_EXISTING singers added, the oldest at
+	// existingStart
+	existing      []SingerAlbum
+	existingStart int
+	// The singers in existing, by singerKey
+	existingKeys = map[string]bool{}
+	// Guards the variables above
+	existingMu sync.Mutex
+)
+
+// The sampler that chooses existing singers and albums
+func GetSampler() Sampler {
+	existingMu.Lock()
+	defer existingMu.Unlock()
+	return sampler
+}
+
+// Set the sampler that chooses existing singers and albums
+func SetSampler(s Sampler) {
+	existingMu.Lock()
+	defer existingMu.Unlock()
+	sampler = s
+}
+
+// Identifies a singer, since the singers are looked up by name
+func singerKey(data SingerAlbum) string {
+	return data.FirstName + "\x00" + data.LastName
+}
+
+// Remember a singer and album that were added, for later reads and updates.
+// A singer is remembered once however many albums are added for it, so that
+// its share of the accesses only depends on the sampler. Once MAX_EXISTING
+// are remembered each new singer replaces the oldest.
+func AddExisting(data SingerAlbum) {
+	existingMu.Lock()
+	defer existingMu.Unlock()
+	key := singerKey(data)
+	if existingKeys[key] {
+		return
+	}
+	existingKeys[key] = true
+	data.CoverArt = nil
+	if len(existing) < MAX_EXISTING {
+		existing = append(existing, data)
+		return
+	}
+	delete(existingKeys, singerKey(existing[existingStart]))
+	existing[existingStart] = data
+	existingStart = (existingStart + 1) % len(existing)
+}
+
+// Forget the singers and albums remembered so far
+func ResetExisting() {
+	existingMu.Lock()
+	defer existingMu.Unlock()
+	existing = nil
+	existingStart = 0
+	existingKeys = map[string]bool{}
+}
+
+// Choose an existing singer and album with the sampler, or false if none has
+// been added yet
+func ExistingSingerAlbum() (SingerAlbum, bool) {
+	existingMu.Lock()
+	defer existingMu.Unlock()
+	if len(existing) == 0 {
+		return SingerAlbum{}, false
+	}
+	i := sampler.Sample(len(existing))
+	return existing[(existingStart+i)%len(existing)], true
+}
+
+// Data for an add: for the hit ratio of the adds a new album for an existing
+// singer chosen with the sampler, otherwise a new random singer and album
+func NextPayload(max PayloadSize) SingerAlbum {
+	data := RandomPayload(max)
+	if random.Float64() < GetHitRatio() {
+		if e, ok := ExistingSingerAlbum(); ok {
+			data.FirstName, data.LastName = e.FirstName, e.LastName
+		}
+	}
+	return data
+}
@@ -0,0 +1,173 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testdata
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/opencensus-spanner-demo/random"
+)
+
+func TestParseSampler(t *testing.T) {
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{"uniform", "uniform"},
+		{"zipf", "zipf:1.1"},
+		{"zipf:1.5", "zipf:1.5"},
+		{"hotspot", "hotspot:0.9:0.1"},
+		{"hotspot:0.8:0.2", "hotspot:0.8:0.2"},
+		{"latest:2", "latest:2"},
+		{"uniform:1", ""},
+		{"zipf:0.5", ""},
+		{"hotspot:0.8", ""},
+		{"hotspot:1.5:0.2", ""},
+		{"normal", ""},
+	}
+	for _, tc := range tests {
+		s, err := ParseSampler(tc.spec)
+		if tc.want == "" {
+			if err == nil {
+				t.Errorf("ParseSampler(%q) = %v, want error", tc.spec, s)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseSampler(%q) error = %v", tc.spec, err)
+		} else if s.String() != tc.want {
+			t.Errorf("ParseSampler(%q) = %v, want %s", tc.spec, s, tc.want)
+		}
+	}
+}
+
+// The share of samples of n items that fall in [lo, hi)
+func share(s Sampler, n, lo, hi int) float64 {
+	const SAMPLES = 10000
+	hits := 0
+	for i := 0; i < SAMPLES; i++ {
+		k := s.Sample(n)
+		if k < 0 || k >= n {
+			panic("sample out of range")
+		}
+		if k >= lo && k < hi {
+			hits++
+		}
+	}
+	return float64(hits) / SAMPLES
+}
+
+func TestSamplerSkew(t *testing.T) {
+	random.Seed(1)
+	const N = 1000
+	tests := []struct {
+		name     string
+		sampler  Sampler
+		lo, hi   int
+		min, max float64
+	}{
+		{"uniform", NewUniformSampler(), 0, 100, 0.07, 0.13},
+		{"zipf", NewZipfSampler(1.5), 0, 10, 0.6, 1},
+		{"hotspot", NewHotspotSampler(0.9, 0.1), 0, 100, 0.87, 0.93},
+		{"latest", NewLatestSampler(1.5), N - 10, N, 0.6, 1},
+	}
+	for _, tc := range tests {
+		got := share(tc.sampler, N, tc.lo, tc.hi)
+		if got < tc.min || got > tc.max {
+			t.Errorf("%s: %.3f of samples in [%d, %d), want %.2f to %.2f",
+				tc.name, got, tc.lo, tc.hi, tc.min, tc.max)
+		}
+	}
+	for _, s := range []Sampler{NewZipfSampler(1.1), NewLatestSampler(1.1),
+		NewHotspotSampler(0.5, 0.5)} {
+		if k := s.Sample(1); k != 0 {
+			t.Errorf("%v sampled %d of 1", s, k)
+		}
+	}
+}
+
+func TestNextPayloadReusesSingers(t *testing.T) {
+	random.Seed(1)
+	ResetExisting()
+	defer ResetExisting()
+	SetSampler(NewUniformSampler())
+	if _, ok := ExistingSingerAlbum(); ok {
+		t.Fatalf("ExistingSingerAlbum() found a singer before any was added")
+	}
+	AddExisting(SingerAlbum{FirstName: "Captain A", LastName: "Zero II"})
+	countReused := func() int {
+		reused := 0
+		for i := 0; i < 100; i++ {
+			data := NextPayload(PayloadSize{})
+			if data.FirstName == "Captain A" && data.LastName == "Zero II" {
+				reused++
+			}
+		}
+		return reused
+	}
+	// Without a hit ratio only a chance collision finds the singer
+	if reused := countReused(); reused > 1 {
+		t.Errorf("%d of 100 adds reused the existing singer by default",
+			reused)
+	}
+	if err := SetHitRatio(0.5); err != nil {
+		t.Fatal(err)
+	}
+	defer SetHitRatio(DEFAULT_HIT_RATIO)
+	if reused := countReused(); reused < 30 || reused > 70 {
+		t.Errorf("%d of 100 adds reused the existing singer, want about 50",
+			reused)
+	}
+}
+
+func TestAddExisting(t *testing.T) {
+	ResetExisting()
+	defer ResetExisting()
+	SetSampler(NewLatestSampler(DEFAULT_ZIPF_S))
+	defer SetSampler(NewUniformSampler())
+	singer := func(i int) SingerAlbum {
+		return SingerAlbum{FirstName: "Captain", LastName: fmt.Sprint(i)}
+	}
+
+	// Adding albums for a remembered singer does not remember it again
+	AddExisting(singer(0))
+	AddExisting(SingerAlbum{FirstName: "Captain", LastName: "0",
+		AlbumTitle: "Fog on the Hills"})
+	if n := len(existing); n != 1 {
+		t.Errorf("%d singers remembered after adding one twice, want 1", n)
+	}
+
+	// Once full, new singers replace the oldest
+	for i := 1; i < MAX_EXISTING+10; i++ {
+		AddExisting(singer(i))
+	}
+	if n := len(existing); n != MAX_EXISTING {
+		t.Fatalf("%d singers remembered, want %d", n, MAX_EXISTING)
+	}
+	if existingKeys[singerKey(singer(9))] {
+		t.Errorf("Singer 9 still remembered after being replaced")
+	}
+	last := singer(MAX_EXISTING + 9)
+	hits := 0
+	for i := 0; i < 100; i++ {
+		if data, _ := ExistingSingerAlbum(); data.LastName == last.LastName {
+			hits++
+		}
+	}
+	if hits == 0 {
+		t.Errorf("Latest sampler never chose the singer added last")
+	}
+}
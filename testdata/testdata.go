@@ -18,8 +18,14 @@ package testdata
 
 import (
 	"fmt"
-	"math/rand"
+	"math"
+	"strings"
+	"sync"
 	"time"
+
+	"cloud.google.com/go/civil"
+
+	"github.com/GoogleCloudPlatform/opencensus-spanner-demo/random"
 )
 
 const (
@@ -30,9 +36,53 @@ const (
 	ACTION_JOIN_SINGER_ALBUM
 	ACTION_ADD_ALL_TXN
 	ACTION_ADD_SINGLE_TXNS
+	ACTION_QUERY_SINGER_ALBUMS
+	ACTION_QUERY_SINGERS_BORN
+	ACTION_QUERY_TOP_BUDGET
+	ACTION_QUERY_RECENT_SINGERS
+	ACTION_QUERY_COVER_ART
+)
+
+const (
+	// Birth years are normally distributed, clamped to the range
+	BIRTH_YEAR_MEAN = 1985
+	BIRTH_YEAR_SD   = 12
+	BIRTH_YEAR_MIN  = 1940
+	BIRTH_YEAR_MAX  = 2005
+	// Length of the birth date range of the QuerySingersBornBetween action
+	BIRTH_RANGE_YEARS = 5
+	// Marketing budgets in dollars are log-normally distributed around the
+	// median, most albums get a modest budget and a few a very large one
+	BUDGET_MEDIAN = 20000
+	BUDGET_SIGMA  = 1.2
+	BUDGET_UNIT   = 100
 )
 
+const (
+	// Values of the --actions flag besides a list of action names
+	ACTIONS_DEFAULT = "default"
+	ACTIONS_ALL     = "all"
+)
+
+// Every action, in the order of the reports
 var ACTIONS = [...]Action{
+	ACTION_QUERY_ALBUMS,
+	ACTION_QUERY_LIMIT,
+	ACTION_QUERY_SINGERS_FIRST,
+	ACTION_QUERY_SINGERS_LAST,
+	ACTION_JOIN_SINGER_ALBUM,
+	ACTION_ADD_ALL_TXN,
+	ACTION_ADD_SINGLE_TXNS,
+	ACTION_QUERY_SINGER_ALBUMS,
+	ACTION_QUERY_SINGERS_BORN,
+	ACTION_QUERY_TOP_BUDGET,
+	ACTION_QUERY_RECENT_SINGERS,
+	ACTION_QUERY_COVER_ART}
+
+// The actions drawn by default. The queries on existing singers and on the
+// generated columns are only drawn when chosen with SetActions, so that they
+// do not change the share of writes in the default mix.
+var DEFAULT_ACTIONS = [...]Action{
 	ACTION_QUERY_ALBUMS,
 	ACTION_QUERY_LIMIT,
 	ACTION_QUERY_SINGERS_FIRST,
@@ -41,25 +91,41 @@ var ACTIONS = [...]Action{
 	ACTION_ADD_ALL_TXN,
 	ACTION_ADD_SINGLE_TXNS}
 
+var (
+	actions   = DEFAULT_ACTIONS[:]
+	actionsMu sync.Mutex
+)
+
 type Action int
 
 type SingerAlbum struct {
 	FirstName, LastName, AlbumTitle string
+	CoverArt                        []byte
+	BirthDate                       civil.Date
+	MarketingBudget                 int64
 }
 
-func init() {
-	rand.Seed(int64(time.Now().UnixNano()))
+// Maximum sizes in bytes of generated album payloads. Zero leaves the title
+// at its natural length and the cover art empty.
+type PayloadSize struct {
+	TitleBytes    int
+	CoverArtBytes int
 }
 
 func (a Action) String() string {
 	names := map[Action]string{
-		ACTION_QUERY_ALBUMS:        "QueryAlbums",
-		ACTION_QUERY_LIMIT:         "QueryLimit",
-		ACTION_QUERY_SINGERS_FIRST: "QuerySingersFirstName",
-		ACTION_QUERY_SINGERS_LAST:  "QuerySingersLastName",
-		ACTION_JOIN_SINGER_ALBUM:   "JoinSingerAlbum",
-		ACTION_ADD_ALL_TXN:         "AddAllInBigTransaction",
-		ACTION_ADD_SINGLE_TXNS:     "AddEachInSingleTransactions",
+		ACTION_QUERY_ALBUMS:         "QueryAlbums",
+		ACTION_QUERY_LIMIT:          "QueryLimit",
+		ACTION_QUERY_SINGERS_FIRST:  "QuerySingersFirstName",
+		ACTION_QUERY_SINGERS_LAST:   "QuerySingersLastName",
+		ACTION_JOIN_SINGER_ALBUM:    "JoinSingerAlbum",
+		ACTION_ADD_ALL_TXN:          "AddAllInBigTransaction",
+		ACTION_ADD_SINGLE_TXNS:      "AddEachInSingleTransactions",
+		ACTION_QUERY_SINGER_ALBUMS:  "QuerySingerAlbums",
+		ACTION_QUERY_SINGERS_BORN:   "QuerySingersBornBetween",
+		ACTION_QUERY_TOP_BUDGET:     "QueryTopBudgetAlbums",
+		ACTION_QUERY_RECENT_SINGERS: "QueryRecentlyUpdatedSingers",
+		ACTION_QUERY_COVER_ART:      "QueryAlbumCoverArt",
 	}
 	if name, ok := names[a]; ok {
 		return name
@@ -68,38 +134,140 @@ func (a Action) String() string {
 	}
 }
 
+// Look up an action by the name returned from String
+func ParseAction(name string) (Action, error) {
+	for _, a := range ACTIONS {
+		if a.String() == name {
+			return a, nil
+		}
+	}
+	return 0, fmt.Errorf("Unknown action %s", name)
+}
+
+// Parse the actions to draw from a list of action names, default or all
+func ParseActions(spec string) ([]Action, error) {
+	switch spec {
+	case ACTIONS_DEFAULT:
+		return DEFAULT_ACTIONS[:], nil
+	case ACTIONS_ALL:
+		return ACTIONS[:], nil
+	}
+	var parsed []Action
+	for _, name := range strings.Split(spec, ",") {
+		a, err := ParseAction(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, a)
+	}
+	return parsed, nil
+}
+
+// The actions that NextUserAction draws from
+func GetActions() []Action {
+	actionsMu.Lock()
+	defer actionsMu.Unlock()
+	return append([]Action(nil), actions...)
+}
+
+// Set the actions that NextUserAction draws from, each equally likely
+func SetActions(a []Action) error {
+	if len(a) == 0 {
+		return fmt.Errorf("No actions to draw from")
+	}
+	actionsMu.Lock()
+	defer actionsMu.Unlock()
+	actions = append([]Action(nil), a...)
+	return nil
+}
+
+// Draw the next action of the simulation
 func NextUserAction() Action {
-	r := rand.Intn(len(ACTIONS))
-	return ACTIONS[r]
+	actionsMu.Lock()
+	defer actionsMu.Unlock()
+	return actions[random.Intn(len(actions))]
 }
 
-// Generate a random name for a singer
+// Generate a random singer and album from the dictionary
 func RandomData() SingerAlbum {
-	rank := []string{"Private", "Brigadier", "Sergeant", "Captain", "Commander",
-		"Chief", "Lieutenant", "Officer", "First Officer", "Major",
-		"General", "Five Star General", "Admiral", "Rear Admiral",
-		"Vice General"}
-	initial := []string{"A", "B", "C", "D", "E", "F", "G", "H", "I", "J", "K",
-		"L", "M", "N", "O", "P", "Q", "R", "S", "T", "U", "V", "W", "X",
-		"Y", "Z"}
-	surname := []string{"Ryan", "General", "Major", "Zero", "Supreme",
-		"Petty officer", "Governor", "In Charge", "Blunder", "Chaos"}
-	generation := []string{"Junior", "II", "III", "IV", "V", "VI", "VII",
-		"VIII", "IX", "X", "XI", "XII", "XIII", "XIV", "XV", "XVI",
-		"XVII", "XVIII", "XIX", "XX"}
-	part1 := []string{"Smoke", "Mist", "Rain", "Fog", "Thunder", "Lightening",
-		"Frost", "Dew", "Snow", "Shadows", "Water", "Grass", "Trees",
-		"Dust", "Wind", "Breeze", "Trash", "Graffiti", "Writing"}
-	part2 := []string{"Water", "River", "Plains", "Road", "Mountain", "Hills",
-		"Sea", "Bay", "Forest", "Highway", "Wall", "Blackboard"}
-	m := rand.Int63n(int64(len(rank)))
-	n := rand.Int63n(int64(len(initial)))
-	p := rand.Int63n(int64(len(surname)))
-	q := rand.Int63n(int64(len(generation)))
-	r := rand.Int63n(int64(len(part1)))
-	s := rand.Int63n(int64(len(part2)))
-	firstName := fmt.Sprintf("%s %s", rank[m], initial[n])
-	lastName := fmt.Sprintf("%s %s", surname[p], generation[q])
-	albumTitle := fmt.Sprintf("%s on the %s", part1[r], part2[s])
-	return SingerAlbum{firstName, lastName, albumTitle}
+	d := GetDictionary()
+	m := random.Int63n(int64(len(d.Rank)))
+	n := random.Int63n(int64(len(d.Initial)))
+	p := random.Int63n(int64(len(d.Surname)))
+	q := random.Int63n(int64(len(d.Generation)))
+	r := random.Int63n(int64(len(d.TitleFirst)))
+	s := random.Int63n(int64(len(d.TitleSecond)))
+	firstName := fmt.Sprintf("%s %s", d.Rank[m], d.Initial[n])
+	lastName := fmt.Sprintf("%s %s%s", d.Surname[p], d.Generation[q],
+		nextNameSuffix())
+	albumTitle := fmt.Sprintf("%s on the %s", d.TitleFirst[r],
+		d.TitleSecond[s])
+	return SingerAlbum{
+		FirstName:       firstName,
+		LastName:        lastName,
+		AlbumTitle:      albumTitle,
+		BirthDate:       RandomBirthDate(),
+		MarketingBudget: RandomBudget(),
+	}
+}
+
+// Generate a birth date with a normally distributed year
+func RandomBirthDate() civil.Date {
+	year := int(math.Round(BIRTH_YEAR_MEAN +
+		BIRTH_YEAR_SD*random.NormFloat64()))
+	if year < BIRTH_YEAR_MIN {
+		year = BIRTH_YEAR_MIN
+	} else if year > BIRTH_YEAR_MAX {
+		year = BIRTH_YEAR_MAX
+	}
+	first := civil.Date{Year: year, Month: time.January, Day: 1}
+	days := civil.Date{Year: year + 1, Month: time.January, Day: 1}.
+		DaysSince(first)
+	return first.AddDays(random.Intn(days))
+}
+
+// Generate a birth date range of BIRTH_RANGE_YEARS starting on January 1st
+// of a random year, for the QuerySingersBornBetween action
+func RandomBirthDateRange() (civil.Date, civil.Date) {
+	year := BIRTH_YEAR_MIN +
+		random.Intn(BIRTH_YEAR_MAX-BIRTH_YEAR_MIN-BIRTH_RANGE_YEARS+2)
+	start := civil.Date{Year: year, Month: time.January, Day: 1}
+	end := civil.Date{Year: year + BIRTH_RANGE_YEARS, Month: time.January,
+		Day: 1}
+	return start, end
+}
+
+// Generate a log-normally distributed marketing budget in whole units
+func RandomBudget() int64 {
+	budget := BUDGET_MEDIAN * math.Exp(BUDGET_SIGMA*random.NormFloat64())
+	return int64(math.Max(1, math.Round(budget/BUDGET_UNIT))) * BUDGET_UNIT
+}
+
+// Generate a random singer and album with a title padded to a random length
+// and random cover art, each up to the given maximum size
+func RandomPayload(max PayloadSize) SingerAlbum {
+	data := RandomData()
+	if max.TitleBytes > len(data.AlbumTitle) {
+		n := len(data.AlbumTitle) +
+			random.Intn(max.TitleBytes-len(data.AlbumTitle)+1)
+		data.AlbumTitle = padTitle(data.AlbumTitle, n)
+	}
+	if max.CoverArtBytes > 0 {
+		data.CoverArt = make([]byte, random.Intn(max.CoverArtBytes+1))
+		random.Read(data.CoverArt)
+	}
+	return data
+}
+
+// Extend a title with random words to exactly n bytes
+func padTitle(title string, n int) string {
+	words := []string{"and", "the", "of", "Smoke", "Rain", "Thunder", "River",
+		"Mountain", "Highway", "Forest", "Breeze", "Shadows", "Sea"}
+	var b strings.Builder
+	b.WriteString(title)
+	for b.Len() < n {
+		b.WriteString(" ")
+		b.WriteString(words[random.Intn(len(words))])
+	}
+	return b.String()[:n]
 }
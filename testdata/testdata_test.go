@@ -0,0 +1,146 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testdata
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/opencensus-spanner-demo/random"
+)
+
+// The actions and data of a short run
+func run() ([]Action, []SingerAlbum) {
+	var actions []Action
+	var data []SingerAlbum
+	for i := 0; i < 20; i++ {
+		actions = append(actions, NextUserAction())
+		data = append(data, RandomPayload(PayloadSize{64, 32}))
+	}
+	return actions, data
+}
+
+func TestSeedReplaysRun(t *testing.T) {
+	random.Seed(42)
+	actions1, data1 := run()
+	random.Seed(42)
+	actions2, data2 := run()
+	for i := range actions1 {
+		if actions1[i] != actions2[i] {
+			t.Fatalf("Action %d = %v, replayed %v", i, actions1[i],
+				actions2[i])
+		}
+		a, b := data1[i], data2[i]
+		if a.FirstName != b.FirstName || a.LastName != b.LastName ||
+			a.AlbumTitle != b.AlbumTitle || !bytes.Equal(a.CoverArt,
+			b.CoverArt) {
+			t.Fatalf("Data %d = %+v, replayed %+v", i, a, b)
+		}
+	}
+
+	random.Seed(43)
+	actions3, _ := run()
+	same := true
+	for i := range actions1 {
+		same = same && actions1[i] == actions3[i]
+	}
+	if same {
+		t.Errorf("Seeds 42 and 43 gave the same actions %v", actions1)
+	}
+}
+
+func TestActions(t *testing.T) {
+	defer SetActions(DEFAULT_ACTIONS[:])
+	drawn := map[Action]bool{}
+	for i := 0; i < 1000; i++ {
+		drawn[NextUserAction()] = true
+	}
+	if len(drawn) != len(DEFAULT_ACTIONS) {
+		t.Errorf("Default mix drew %v, want %v", drawn, DEFAULT_ACTIONS)
+	}
+
+	tests := []struct {
+		spec    string
+		want    int
+		wantErr bool
+	}{
+		{ACTIONS_DEFAULT, len(DEFAULT_ACTIONS), false},
+		{ACTIONS_ALL, len(ACTIONS), false},
+		{"QuerySingerAlbums, AddAllInBigTransaction", 2, false},
+		{"QueryNothing", 0, true},
+	}
+	for _, tc := range tests {
+		got, err := ParseActions(tc.spec)
+		if (err != nil) != tc.wantErr || len(got) != tc.want {
+			t.Errorf("ParseActions(%q) = %v, %v, want %d actions", tc.spec,
+				got, err, tc.want)
+		}
+	}
+
+	if err := SetActions(nil); err == nil {
+		t.Errorf("SetActions(nil) succeeded")
+	}
+	SetActions([]Action{ACTION_QUERY_TOP_BUDGET})
+	if a := NextUserAction(); a != ACTION_QUERY_TOP_BUDGET {
+		t.Errorf("NextUserAction() = %v, want %v", a, ACTION_QUERY_TOP_BUDGET)
+	}
+}
+
+func TestRandomPayload(t *testing.T) {
+	random.Seed(1)
+	for i := 0; i < 200; i++ {
+		data := RandomPayload(PayloadSize{TitleBytes: 80, CoverArtBytes: 512})
+		if n := len(data.AlbumTitle); n > 80 {
+			t.Fatalf("RandomPayload() title %q has %d bytes, want at most 80",
+				data.AlbumTitle, n)
+		}
+		if n := len(data.CoverArt); n > 512 {
+			t.Fatalf("RandomPayload() cover art has %d bytes, want at most 512",
+				n)
+		}
+	}
+
+	random.Seed(1)
+	natural := RandomData()
+	random.Seed(1)
+	data := RandomPayload(PayloadSize{})
+	if data.AlbumTitle != natural.AlbumTitle || data.CoverArt != nil {
+		t.Errorf("RandomPayload() with no sizes = %q, %d bytes of cover art, "+
+			"want %q and none", data.AlbumTitle, len(data.CoverArt),
+			natural.AlbumTitle)
+	}
+
+	// A maximum below the natural title length leaves the title as it is
+	random.Seed(1)
+	data = RandomPayload(PayloadSize{TitleBytes: 1})
+	if data.AlbumTitle != natural.AlbumTitle {
+		t.Errorf("RandomPayload() with a 1 byte title = %q, want %q",
+			data.AlbumTitle, natural.AlbumTitle)
+	}
+}
+
+func TestPadTitle(t *testing.T) {
+	for _, n := range []int{5, 6, 7, 20, 100, 1000} {
+		got := padTitle("Smoke", n)
+		if len(got) != n {
+			t.Errorf("padTitle(%q, %d) has %d bytes", "Smoke", n, len(got))
+		}
+		if !strings.HasPrefix(got, "Smoke") {
+			t.Errorf("padTitle(%q, %d) = %q, want the title first", "Smoke",
+				n, got)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package update
+
+/**
+  Application errors that keep the underlying Spanner error and classify it
+  for metric tags and span status.
+ **/
+
+import (
+	"context"
+	"errors"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	NOT_FOUND     = -1
+	SPANNER_ERROR = -2
+)
+
+// Error classes used as tag values
+const (
+	ERROR_NONE              = "none"
+	ERROR_NOT_FOUND         = "not_found"
+	ERROR_ABORTED           = "aborted"
+	ERROR_DEADLINE_EXCEEDED = "deadline_exceeded"
+	ERROR_PERMISSION        = "permission"
+	ERROR_RETRYABLE         = "retryable"
+	ERROR_OTHER             = "other"
+)
+
+type AppError struct {
+	Message string
+	Code    int
+	Status  codes.Code
+	Err     error
+}
+
+// Wrap an error from Spanner, keeping its gRPC status code
+func newAppError(err error) *AppError {
+	return &AppError{
+		Message: err.Error(),
+		Code:    SPANNER_ERROR,
+		Status:  StatusCode(err),
+		Err:     err,
+	}
+}
+
+func (e AppError) Error() string {
+	return e.Message
+}
+
+func (e AppError) Unwrap() error {
+	return e.Err
+}
+
+// Expose the status code so that the Spanner client still sees, for example,
+// an aborted transaction when the error is returned from a transaction
+// function
+func (e AppError) GRPCStatus() *status.Status {
+	if e.Code == NOT_FOUND {
+		return status.New(codes.NotFound, e.Message)
+	}
+	return status.New(e.Status, e.Message)
+}
+
+// The class of the error, one of the ERROR_* constants
+func (e AppError) Class() string {
+	if e.Code == NOT_FOUND {
+		return ERROR_NOT_FOUND
+	}
+	return classifyCode(e.Status)
+}
+
+// Classify any error returned from the query or update functions
+func Classify(err error) string {
+	if err == nil {
+		return ERROR_NONE
+	}
+	var e *AppError
+	if errors.As(err, &e) {
+		return e.Class()
+	}
+	return classifyCode(StatusCode(err))
+}
+
+// The gRPC status code of an error, which may be wrapped
+func StatusCode(err error) codes.Code {
+	if err == nil {
+		return codes.OK
+	}
+	var e *AppError
+	if errors.As(err, &e) {
+		return e.GRPCStatus().Code()
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return codes.DeadlineExceeded
+	}
+	return spanner.ErrCode(err)
+}
+
+func classifyCode(code codes.Code) string {
+	switch code {
+	case codes.OK:
+		return ERROR_NONE
+	case codes.NotFound:
+		return ERROR_NOT_FOUND
+	case codes.Aborted:
+		return ERROR_ABORTED
+	case codes.DeadlineExceeded:
+		return ERROR_DEADLINE_EXCEEDED
+	case codes.PermissionDenied, codes.Unauthenticated:
+		return ERROR_PERMISSION
+	case codes.Unavailable, codes.ResourceExhausted:
+		return ERROR_RETRYABLE
+	default:
+		return ERROR_OTHER
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package update
+
+/**
+  Primary key generation strategies for new singers and albums. Random keys
+  spread writes across splits, monotonically increasing keys concentrate them
+  on the last split, which surfaces as a hotspot in write latency.
+ **/
+
+import (
+	"fmt"
+	"math/bits"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/opencensus-spanner-demo/random"
+	"github.com/GoogleCloudPlatform/opencensus-spanner-demo/spannerdb"
+)
+
+const (
+	KEY_RANDOM KeyStrategy = iota + 1
+	KEY_SEQUENTIAL
+	KEY_BIT_REVERSED
+	KEY_UUID
+)
+
+var KEY_STRATEGIES = [...]KeyStrategy{
+	KEY_RANDOM,
+	KEY_SEQUENTIAL,
+	KEY_BIT_REVERSED,
+	KEY_UUID}
+
+// A primary key value, see spannerdb.Key
+type Key = spannerdb.Key
+
+type KeyStrategy int
+
+var (
+	keyStrategy = KEY_RANDOM
+	keyMu       sync.Mutex
+	lastSeq     int64
+)
+
+func (s KeyStrategy) String() string {
+	names := map[KeyStrategy]string{
+		KEY_RANDOM:       "random",
+		KEY_SEQUENTIAL:   "sequential",
+		KEY_BIT_REVERSED: "bit_reversed",
+		KEY_UUID:         "uuid",
+	}
+	if name, ok := names[s]; ok {
+		return name
+	} else {
+		return "unknown"
+	}
+}
+
+// Look up a key strategy by the name returned from String
+func ParseKeyStrategy(name string) (KeyStrategy, error) {
+	for _, s := range KEY_STRATEGIES {
+		if s.String() == name {
+			return s, nil
+		}
+	}
+	return 0, fmt.Errorf("Unknown key strategy %s", name)
+}
+
+// The strategy used for keys of new singers and albums
+func GetKeyStrategy() KeyStrategy {
+	keyMu.Lock()
+	defer keyMu.Unlock()
+	return keyStrategy
+}
+
+// Set the strategy used for keys of new singers and albums. The UUID strategy
+// needs the STRING(36) key schema described in the README.
+func SetKeyStrategy(s KeyStrategy) {
+	keyMu.Lock()
+	defer keyMu.Unlock()
+	keyStrategy = s
+}
+
+// Generate a primary key for a new row with the current strategy
+func nextKey() Key {
+	keyMu.Lock()
+	defer keyMu.Unlock()
+	switch keyStrategy {
+	case KEY_SEQUENTIAL:
+		return nextSeq()
+	case KEY_BIT_REVERSED:
+		// Reverse the 63 low bits so that the key stays positive
+		return int64(bits.Reverse64(uint64(nextSeq())) >> 1)
+	case KEY_UUID:
+		return newUUID()
+	default:
+		return random.Int63()
+	}
+}
+
+// Next value of a timestamp-based sequence, strictly increasing even when the
+// clock does not advance between calls. Must be called holding keyMu.
+func nextSeq() int64 {
+	seq := time.Now().UnixNano()
+	if seq <= lastSeq {
+		seq = lastSeq + 1
+	}
+	lastSeq = seq
+	return seq
+}
+
+// Format a random (version 4) UUID. The bits come from the random sequence of
+// the run, so a run replayed with its seed inserts the same UUIDs.
+func newUUID() string {
+	var u [16]byte
+	random.Read(u[:])
+	u[6] = (u[6] & 0x0f) | 0x40
+	u[8] = (u[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10],
+		u[10:])
+}
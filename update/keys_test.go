@@ -0,0 +1,121 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package update
+
+import (
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/opencensus-spanner-demo/random"
+)
+
+// Draw n keys with the strategy s in each of g goroutines
+func concurrentKeys(t *testing.T, s KeyStrategy, g, n int) [][]Key {
+	defer SetKeyStrategy(GetKeyStrategy())
+	SetKeyStrategy(s)
+	keys := make([][]Key, g)
+	var wg sync.WaitGroup
+	for i := range keys {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < n; j++ {
+				keys[i] = append(keys[i], nextKey())
+			}
+		}(i)
+	}
+	wg.Wait()
+	return keys
+}
+
+func TestParseKeyStrategy(t *testing.T) {
+	for _, s := range KEY_STRATEGIES {
+		got, err := ParseKeyStrategy(s.String())
+		if err != nil {
+			t.Fatalf("ParseKeyStrategy(%q) error = %v", s.String(), err)
+		}
+		if got != s {
+			t.Errorf("ParseKeyStrategy(%q) = %v, want %v", s.String(), got, s)
+		}
+	}
+	for _, name := range []string{"", "unknown", "Random", "bit-reversed",
+		" uuid"} {
+		if got, err := ParseKeyStrategy(name); err == nil {
+			t.Errorf("ParseKeyStrategy(%q) = %v, want error", name, got)
+		}
+	}
+}
+
+func TestSequentialKeysIncrease(t *testing.T) {
+	seen := map[int64]bool{}
+	for _, keys := range concurrentKeys(t, KEY_SEQUENTIAL, 8, 500) {
+		last := int64(-1)
+		for _, k := range keys {
+			seq := k.(int64)
+			if seq <= last {
+				t.Fatalf("Sequential key %d after %d", seq, last)
+			}
+			if seen[seq] {
+				t.Fatalf("Sequential key %d drawn twice", seq)
+			}
+			seen[seq] = true
+			last = seq
+		}
+	}
+}
+
+func TestBitReversedKeys(t *testing.T) {
+	seen := map[int64]bool{}
+	for _, keys := range concurrentKeys(t, KEY_BIT_REVERSED, 8, 500) {
+		for _, k := range keys {
+			key := k.(int64)
+			if key <= 0 {
+				t.Fatalf("Bit reversed key %d is not positive", key)
+			}
+			if seen[key] {
+				t.Fatalf("Bit reversed key %d drawn twice", key)
+			}
+			seen[key] = true
+		}
+	}
+}
+
+func TestNewUUID(t *testing.T) {
+	// Version 4 in the 13th digit, RFC 4122 variant in the 17th
+	format := regexp.MustCompile(
+		`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	seen := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		u := newUUID()
+		if !format.MatchString(u) {
+			t.Fatalf("newUUID() = %q, not a version 4 UUID", u)
+		}
+		if seen[u] {
+			t.Fatalf("newUUID() returned %q twice", u)
+		}
+		seen[u] = true
+	}
+}
+
+func TestSeedReplaysUUIDs(t *testing.T) {
+	random.Seed(7)
+	first := newUUID()
+	random.Seed(7)
+	if replayed := newUUID(); replayed != first {
+		t.Errorf("newUUID() after the same seed = %q, want %q", replayed,
+			first)
+	}
+}
@@ -19,224 +19,255 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"math/rand"
 
 	"cloud.google.com/go/spanner"
 	"google.golang.org/api/iterator"
 
 	log "github.com/GoogleCloudPlatform/opencensus-spanner-demo/applog"
+	"github.com/GoogleCloudPlatform/opencensus-spanner-demo/spannerdb"
+	"github.com/GoogleCloudPlatform/opencensus-spanner-demo/testdata"
 )
 
-const (
-	NOT_FOUND     = -1
-	SPANNER_ERROR = -2
-)
-
-type AppError struct {
-	Message string
-	Code    int
-}
-
-func (e AppError) Error() string {
-	return e.Message
+// The outcome of adding a singer and album, saying which of them were created
+// and which were found already in the database
+type AddResult struct {
+	SingerId      Key
+	AlbumId       Key
+	SingerCreated bool
+	AlbumCreated  bool
 }
 
-func albumNotFound(albumId int64, albumTitle string) *AppError {
-	msg := fmt.Sprintf("Singer-Album %d %s not found", albumId, albumTitle)
-	return &AppError{msg, NOT_FOUND}
+func albumNotFound(singerId Key, albumTitle string) *AppError {
+	msg := fmt.Sprintf("Singer-Album %v %s not found", singerId, albumTitle)
+	return &AppError{Message: msg, Code: NOT_FOUND}
 }
 
-// Adds a singer-album with a random  album id, not checking for existence
+// Adds a singer-album with a generated album id, not checking for existence
 // Returns: The id of the newly created album
-func addAlbum(ctx context.Context, client *spanner.Client, singerId int64,
-	albumTitle string) (*int64, error) {
-	albumId := rand.Int63()
+func addAlbum(ctx context.Context, client spannerdb.Client, singerId Key,
+	data testdata.SingerAlbum) (Key, error) {
+	albumId := nextKey()
 	_, err := client.ReadWriteTransaction(ctx, func(ctx context.Context,
-		txn *spanner.ReadWriteTransaction) error {
-		stmt := spanner.Statement{
-			SQL: `INSERT Albums (SingerId, AlbumId, AlbumTitle) VALUES
-            (@SingerId, @AlbumId, @AlbumTitle)`,
-			Params: map[string]interface{}{
-				"SingerId":   singerId,
-				"AlbumId":    albumId,
-				"AlbumTitle": albumTitle,
-			},
-		}
+		txn spannerdb.ReadWriteTransaction) error {
+		stmt := insertAlbum(singerId, albumId, data)
 		rowCount, err := txn.Update(ctx, stmt)
 		if err != nil {
 			return err
 		}
-		log.Printf(ctx, "%d record(s) inserted.\n", rowCount)
+		log.Debug(ctx, "Records inserted", log.F(log.FIELD_ROWS, rowCount))
 		return nil
 	})
-	return &albumId, err
+	return albumId, err
 }
 
 // Adds a singer and album first checking for the existence of the singer but
-// not in the same transaction.
-// Returns: The id of the singer, either existing or newly created
-func AddAllNoTxn(ctx context.Context, client *spanner.Client,
-	firstName, lastName, albumTitle string) (*int64, error) {
-	singerId, e := getSingerId(ctx, client, nil, firstName, lastName)
+// not in the same transaction. The cover art, birth date and marketing budget
+// are only written if set.
+// Returns: The ids of the singer and album, either existing or newly created
+func AddAllNoTxn(ctx context.Context, client spannerdb.Client,
+	data testdata.SingerAlbum) (*AddResult, error) {
+	result := &AddResult{}
+	var e *AppError
+	result.SingerId, e = getSingerId(ctx, client, nil, data.FirstName,
+		data.LastName)
 	if e != nil && e.Code != NOT_FOUND {
-		log.Printf(ctx, "Error looking up singer")
-		return nil, errors.New(e.Message)
+		log.Warningf(ctx, "Error looking up singer")
+		return nil, e
 	}
 	if e != nil && e.Code == NOT_FOUND {
 		var err error
-		singerId, err = addSinger(ctx, client, firstName, lastName)
+		result.SingerId, err = addSinger(ctx, client, data)
 		if err != nil {
-			log.Printf(ctx, "Could not add singer")
+			log.Warningf(ctx, "Could not add singer")
 			return nil, err
 		}
+		result.SingerCreated = true
 	}
-	var albumId *int64
-	albumId, e = getAlbumId(ctx, client, nil, singerId, albumTitle)
+	result.AlbumId, e = getAlbumId(ctx, client, nil, result.SingerId,
+		data.AlbumTitle)
 	if e != nil && e.Code != NOT_FOUND {
-		log.Printf(ctx, "Error looking up album")
-		return nil, errors.New(e.Message)
+		log.Warningf(ctx, "Error looking up album")
+		return nil, e
 	}
 	if e != nil && e.Code == NOT_FOUND {
 		var err error
-		albumId, err = addAlbum(ctx, client, singerId, albumTitle)
+		result.AlbumId, err = addAlbum(ctx, client, result.SingerId, data)
 		if err != nil {
-			log.Printf(ctx, "Could not add album")
+			log.Warningf(ctx, "Could not add album")
 			return nil, err
 		}
+		result.AlbumCreated = true
 	}
-	return albumId, nil
+	return result, nil
 }
 
-// Adds a singer and album first checking for existence within the transaction
-// Return the album id created or that already existed
-func AddAllTxn(ctx context.Context, client *spanner.Client,
-	firstName, lastName, albumTitle string) (*int64, error) {
-	var albumId *int64
+// Adds a singer and album first checking for existence within the transaction.
+// The cover art, birth date and marketing budget are only written if set.
+// Returns: The ids of the singer and album, either existing or newly created
+func AddAllTxn(ctx context.Context, client spannerdb.Client,
+	data testdata.SingerAlbum) (*AddResult, error) {
+	var result *AddResult
+	// Draw the keys before the transaction, so that an aborted attempt is
+	// retried with the same keys and does not advance the random sequence
+	newSingerId, newAlbumId := nextKey(), nextKey()
 	_, err := client.ReadWriteTransaction(ctx, func(ctx context.Context,
-		txn *spanner.ReadWriteTransaction) error {
-		// adds the singer with given singerId and name
-		addAlbum := func(singerId int64, albumTitle string) (*int64, error) {
-			albumId := rand.Int63()
-			stmt := spanner.Statement{
-				SQL: `INSERT Albums (SingerId, AlbumId, AlbumTitle) VALUES
-            (@SingerId, @AlbumId, @AlbumTitle)`,
-				Params: map[string]interface{}{
-					"SingerId":   singerId,
-					"AlbumId":    albumId,
-					"AlbumTitle": albumTitle,
-				},
-			}
+		txn spannerdb.ReadWriteTransaction) error {
+		// The function may be retried, so start each attempt afresh
+		result = &AddResult{}
+
+		// adds the album for the given singerId
+		addAlbum := func(singerId Key) (Key, error) {
+			stmt := insertAlbum(singerId, newAlbumId, data)
 			_, err := txn.Update(ctx, stmt)
-			return &albumId, err
+			return newAlbumId, err
 		}
 
-		addSinger := func(firstName, lastName string) (int64, error) {
-			singerId := rand.Int63()
-			stmt := spanner.Statement{
-				SQL: `INSERT Singers (SingerId, FirstName, LastName) VALUES
-              (@SingerId, @FirstName, @LastName)`,
-				Params: map[string]interface{}{
-					"SingerId":  singerId,
-					"FirstName": firstName,
-					"LastName":  lastName,
-				},
-			}
-			_, err := txn.Update(ctx, stmt)
+		addSinger := func() (Key, error) {
+			singerId := newSingerId
+			_, err := txn.Update(ctx, insertSinger(singerId, data))
 			return singerId, err
 		}
 
-		singerId, e := getSingerId(ctx, client, txn, firstName, lastName)
+		var e *AppError
+		result.SingerId, e = getSingerId(ctx, client, txn, data.FirstName,
+			data.LastName)
 		if e != nil && e.Code != NOT_FOUND {
-			return errors.New(e.Message)
-		}
-		if e == nil {
-			return nil
+			return e
 		}
 		// The singer will be added only if they do not exist already
-		var err error
-		singerId, err = addSinger(firstName, lastName)
-		if err != nil {
-			return err
+		if e != nil && e.Code == NOT_FOUND {
+			var err error
+			result.SingerId, err = addSinger()
+			if err != nil {
+				return err
+			}
+			result.SingerCreated = true
+			log.Debugf(ctx, "Added singer %s %s in transaction",
+				data.FirstName, data.LastName)
 		}
-		log.Printf(ctx, "Added singer %s %s in transaction", firstName, lastName)
 
 		// Add album
-		albumId, e = getAlbumId(ctx, client, txn, singerId, albumTitle)
+		result.AlbumId, e = getAlbumId(ctx, client, txn, result.SingerId,
+			data.AlbumTitle)
 		if e != nil && e.Code != NOT_FOUND {
-			log.Printf(ctx, "Error looking up album")
-			return errors.New(e.Message)
+			log.Warningf(ctx, "Error looking up album")
+			return e
 		}
 		if e != nil && e.Code == NOT_FOUND {
 			var err error
-			albumId, err = addAlbum(singerId, albumTitle)
+			result.AlbumId, err = addAlbum(result.SingerId)
 			if err != nil {
-				log.Printf(ctx, "Could not add album")
+				log.Warningf(ctx, "Could not add album")
 				return err
 			}
+			result.AlbumCreated = true
 		}
 		return nil
 	})
-	return albumId, err
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Build the statement to insert an album, including the CoverArt column only
+// if there is cover art so that the base schema also works. A zero marketing
+// budget is written as NULL.
+func insertAlbum(singerId, albumId Key,
+	data testdata.SingerAlbum) spanner.Statement {
+	params := map[string]interface{}{
+		"SingerId":   singerId,
+		"AlbumId":    albumId,
+		"AlbumTitle": data.AlbumTitle,
+		"MarketingBudget": spanner.NullInt64{
+			Int64: data.MarketingBudget,
+			Valid: data.MarketingBudget != 0,
+		},
+	}
+	if data.CoverArt == nil {
+		return spanner.Statement{
+			SQL: `INSERT Albums (SingerId, AlbumId, AlbumTitle, MarketingBudget)
+            VALUES (@SingerId, @AlbumId, @AlbumTitle, @MarketingBudget)`,
+			Params: params,
+		}
+	}
+	params["CoverArt"] = data.CoverArt
+	return spanner.Statement{
+		SQL: `INSERT Albums
+            (SingerId, AlbumId, AlbumTitle, MarketingBudget, CoverArt)
+            VALUES (@SingerId, @AlbumId, @AlbumTitle, @MarketingBudget,
+            @CoverArt)`,
+		Params: params,
+	}
 }
 
-// Adds a singer with a random id, not checking for the existence of the singer.
+// Build the statement to insert a singer. LastUpdated is set to the commit
+// timestamp, which needs the allow_commit_timestamp option on the column. An
+// unset birth date is written as NULL.
+func insertSinger(singerId Key, data testdata.SingerAlbum) spanner.Statement {
+	return spanner.Statement{
+		SQL: `INSERT Singers
+            (SingerId, FirstName, LastName, BirthDate, LastUpdated)
+            VALUES (@SingerId, @FirstName, @LastName, @BirthDate,
+            PENDING_COMMIT_TIMESTAMP())`,
+		Params: map[string]interface{}{
+			"SingerId":  singerId,
+			"FirstName": data.FirstName,
+			"LastName":  data.LastName,
+			"BirthDate": spanner.NullDate{
+				Date:  data.BirthDate,
+				Valid: data.BirthDate.IsValid(),
+			},
+		},
+	}
+}
+
+// Adds a singer with a generated id, not checking for the existence of the
+// singer.
 // Returns: The id of the newly created singer
-func addSinger(ctx context.Context, client *spanner.Client,
-	firstName, lastName string) (int64, error) {
-	singerId := rand.Int63()
+func addSinger(ctx context.Context, client spannerdb.Client,
+	data testdata.SingerAlbum) (Key, error) {
+	singerId := nextKey()
 	_, err := client.ReadWriteTransaction(ctx, func(ctx context.Context,
-		txn *spanner.ReadWriteTransaction) error {
-		stmt := spanner.Statement{
-			SQL: `INSERT Singers (SingerId, FirstName, LastName) VALUES
-            (@SingerId, @FirstName, @LastName)`,
-			Params: map[string]interface{}{
-				"SingerId":  singerId,
-				"FirstName": firstName,
-				"LastName":  lastName,
-			},
-		}
-		rowCount, err := txn.Update(ctx, stmt)
+		txn spannerdb.ReadWriteTransaction) error {
+		rowCount, err := txn.Update(ctx, insertSinger(singerId, data))
 		if err != nil {
 			return err
 		}
-		log.Printf(ctx, "%d record(s) inserted.\n", rowCount)
+		log.Debug(ctx, "Records inserted", log.F(log.FIELD_ROWS, rowCount))
 		return nil
 	})
 	return singerId, err
 }
 
-// Count the singers with a select query
-func CountRows(client *spanner.Client,
+// Count the rows in a table with a select query
+func CountRows(ctx context.Context, client spannerdb.Client,
 	fieldName, tableName string) (int64, error) {
-	ctx := context.Background()
 	selectCount := fmt.Sprintf("SELECT COUNT(%s) FROM %s", fieldName, tableName)
 	stmt := spanner.Statement{
 		SQL: selectCount,
 	}
 	iter := client.Single().Query(ctx, stmt)
 	defer iter.Stop()
-	for {
-		row, err := iter.Next()
-		if err == iterator.Done {
-			return -1, errors.New("No results")
-		}
-		if err != nil {
-			return -1, err
-		}
-		var count int64
-		err = row.Columns(&count)
-		if err != nil {
-			return -1, err
-		}
-		return count, nil
+	row, err := iter.Next()
+	if err == iterator.Done {
+		return -1, errors.New("No results")
+	}
+	if err != nil {
+		return -1, newAppError(err)
 	}
-	return -1, errors.New("No results")
+	var count int64
+	err = row.Columns(&count)
+	if err != nil {
+		return -1, newAppError(err)
+	}
+	return count, nil
 }
 
 // Return the id, if the album with given singer and title is in the database
-func getAlbumId(ctx context.Context, client *spanner.Client,
-	txn *spanner.ReadWriteTransaction, singerId int64,
-	albumTitle string) (*int64, *AppError) {
+func getAlbumId(ctx context.Context, client spannerdb.Client,
+	txn spannerdb.ReadWriteTransaction, singerId Key,
+	albumTitle string) (Key, *AppError) {
 	stmt := spanner.Statement{
 		SQL: `SELECT
             SingerId, AlbumId
@@ -249,40 +280,34 @@ func getAlbumId(ctx context.Context, client *spanner.Client,
 		},
 	}
 	// Reuse transaction if not nil
-	var iter *spanner.RowIterator
+	var iter spannerdb.RowIterator
 	if txn != nil {
 		iter = txn.Query(ctx, stmt)
 	} else {
 		iter = client.Single().Query(ctx, stmt)
 	}
 	defer iter.Stop()
-	for {
-		row, err := iter.Next()
-		if err == iterator.Done {
-			return nil, albumNotFound(singerId, albumTitle)
-		}
-		if err != nil {
-			return nil, &AppError{err.Error(), SPANNER_ERROR}
-		}
-		var singerID int64
-		if row.Columns(&singerID) != nil {
-			log.Printf(ctx, "Failed to parse row")
-		}
-		var albumId int64
-		if row.Columns(&albumId) != nil {
-			log.Printf(ctx, "Failed to parse row")
-		}
-		return &albumId, nil
+	row, err := iter.Next()
+	if err == iterator.Done {
+		return nil, albumNotFound(singerId, albumTitle)
+	}
+	if err != nil {
+		return nil, newAppError(err)
+	}
+	albumId, err := spannerdb.ColumnKey(row, 1)
+	if err != nil {
+		log.Warningf(ctx, "Failed to parse row")
+		return nil, newAppError(err)
 	}
-	return nil, albumNotFound(singerId, albumTitle)
+	return albumId, nil
 }
 
 // If the singer is in the database then return the id.
 // If a transaction is supplied then use it. Otherwise, create a new, single
 // query transaction.
-func getSingerId(ctx context.Context, client *spanner.Client,
-	txn *spanner.ReadWriteTransaction,
-	firstName, lastName string) (int64, *AppError) {
+func getSingerId(ctx context.Context, client spannerdb.Client,
+	txn spannerdb.ReadWriteTransaction,
+	firstName, lastName string) (Key, *AppError) {
 	stmt := spanner.Statement{
 		SQL: `SELECT SingerId FROM Singers 
           WHERE FirstName = @FirstName AND LastName = @LastName`,
@@ -292,28 +317,25 @@ func getSingerId(ctx context.Context, client *spanner.Client,
 		},
 	}
 	// Reuse transaction if not nil
-	var iter *spanner.RowIterator
+	var iter spannerdb.RowIterator
 	if txn != nil {
 		iter = txn.Query(ctx, stmt)
 	} else {
 		iter = client.Single().Query(ctx, stmt)
 	}
 	defer iter.Stop()
-	for {
-		row, err := iter.Next()
-		if err == iterator.Done {
-			msg := fmt.Sprintf("Singer not found", firstName, lastName)
-			return -1, &AppError{msg, NOT_FOUND}
-		}
-		if err != nil {
-			return -1, &AppError{err.Error(), SPANNER_ERROR}
-		}
-		var singerID int64
-		if row.Columns(&singerID) != nil {
-			log.Printf(ctx, "Failed to parse row")
-		}
-		return singerID, nil
+	row, err := iter.Next()
+	if err == iterator.Done {
+		msg := fmt.Sprintf("Singer %s %s not found", firstName, lastName)
+		return nil, &AppError{Message: msg, Code: NOT_FOUND}
+	}
+	if err != nil {
+		return nil, newAppError(err)
+	}
+	singerId, err := spannerdb.ColumnKey(row, 0)
+	if err != nil {
+		log.Warningf(ctx, "Failed to parse row")
+		return nil, newAppError(err)
 	}
-	msg := fmt.Sprintf("Singer %s %s not found", firstName, lastName)
-	return -1, &AppError{msg, NOT_FOUND}
+	return singerId, nil
 }
@@ -0,0 +1,376 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package update
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"go.opencensus.io/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/GoogleCloudPlatform/opencensus-spanner-demo/internal/recorder"
+	"github.com/GoogleCloudPlatform/opencensus-spanner-demo/internal/spannerdbfake"
+	"github.com/GoogleCloudPlatform/opencensus-spanner-demo/internal/spannerfake"
+	"github.com/GoogleCloudPlatform/opencensus-spanner-demo/random"
+	"github.com/GoogleCloudPlatform/opencensus-spanner-demo/spannerdb"
+	"github.com/GoogleCloudPlatform/opencensus-spanner-demo/testdata"
+)
+
+// Spans for Spanner RPCs and client library operations. Sessions are created
+// and prepared in the background by the session pool, so those RPCs have no
+// parent in the application.
+func isSpannerSpan(name string) bool {
+	for _, rpc := range []string{"CreateSession", "BatchCreateSessions",
+		"GetSession", "DeleteSession"} {
+		if strings.HasSuffix(name, "."+rpc) {
+			return false
+		}
+	}
+	return strings.HasPrefix(name, "google.spanner.v1.Spanner.") ||
+		strings.HasPrefix(name, "cloud.google.com/go/spanner.")
+}
+
+func TestSpannerSpansHaveParent(t *testing.T) {
+	ctx := context.Background()
+	srv := spannerfake.New()
+	defer srv.Close()
+	srv.AddResult("COUNT(", []string{"Count"}, []interface{}{int64(3)})
+	srv.AddResult("SELECT SingerId FROM Singers", []string{"SingerId"},
+		[]interface{}{int64(1)})
+	spannerClient, err := srv.Client(ctx)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer spannerClient.Close()
+	client := spannerdb.Wrap(spannerClient)
+
+	rec := recorder.New()
+	defer rec.Close()
+
+	tests := []struct {
+		name string
+		run  func(ctx context.Context, client spannerdb.Client) error
+	}{
+		{"CountRows", func(ctx context.Context,
+			client spannerdb.Client) error {
+			_, err := CountRows(ctx, client, "SingerId", "Singers")
+			return err
+		}},
+		{"AddAllNoTxn", func(ctx context.Context,
+			client spannerdb.Client) error {
+			_, err := AddAllNoTxn(ctx, client, testdata.SingerAlbum{
+				FirstName:  "Captain A",
+				LastName:   "Zero II",
+				AlbumTitle: "Rain on the Road",
+			})
+			return err
+		}},
+		{"AddAllTxn", func(ctx context.Context,
+			client spannerdb.Client) error {
+			_, err := AddAllTxn(ctx, client, testdata.SingerAlbum{
+				FirstName:  "Captain A",
+				LastName:   "Zero II",
+				AlbumTitle: "Rain on the Road",
+			})
+			return err
+		}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec.Reset()
+			ctx, root := trace.StartSpan(ctx, "root")
+			err := tc.run(ctx, client)
+			root.End()
+			if err != nil {
+				t.Fatalf("%s failed: %v", tc.name, err)
+			}
+			rootData := rec.AssertSpan(t, "root")
+			found := 0
+			for _, s := range rec.Spans() {
+				if !isSpannerSpan(s.Name) {
+					continue
+				}
+				found++
+				if !rec.IsDescendant(s, rootData) {
+					t.Errorf("Span %s is not a descendant of the root span",
+						s.Name)
+				}
+			}
+			if found == 0 {
+				t.Errorf("No Spanner spans recorded")
+			}
+		})
+	}
+}
+
+// A fake database with one singer who has one album
+func newFake() *spannerdbfake.Fake {
+	fake := spannerdbfake.New()
+	fake.Insert("Singers", spannerdbfake.Record{
+		"SingerId":  int64(7),
+		"FirstName": "Captain A",
+		"LastName":  "Zero II",
+	})
+	fake.Insert("Albums", spannerdbfake.Record{
+		"SingerId":   int64(7),
+		"AlbumId":    int64(70),
+		"AlbumTitle": "Rain on the Road",
+	})
+	return fake
+}
+
+func TestGetSingerId(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "unavailable")
+	tests := []struct {
+		name      string
+		firstName string
+		lastName  string
+		fail      error
+		want      Key
+		wantCode  int
+	}{
+		{"found", "Captain A", "Zero II", nil, int64(7), 0},
+		{"not found", "Major B", "Zero II", nil, nil, NOT_FOUND},
+		{"spanner error", "Captain A", "Zero II", unavailable, nil,
+			SPANNER_ERROR},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := newFake()
+			if tc.fail != nil {
+				fake.FailOn("FROM Singers", tc.fail)
+			}
+			got, e := getSingerId(context.Background(), fake, nil,
+				tc.firstName, tc.lastName)
+			if tc.wantCode != 0 {
+				if e == nil || e.Code != tc.wantCode {
+					t.Fatalf("getSingerId() error = %v, want code %d", e,
+						tc.wantCode)
+				}
+				return
+			}
+			if e != nil {
+				t.Fatalf("getSingerId() error = %v", e)
+			}
+			if got != tc.want {
+				t.Errorf("getSingerId() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestGetAlbumId(t *testing.T) {
+	aborted := status.Error(codes.Aborted, "aborted")
+	tests := []struct {
+		name      string
+		singerId  Key
+		title     string
+		fail      error
+		want      Key
+		wantClass string
+	}{
+		{"found", int64(7), "Rain on the Road", nil, int64(70), ERROR_NONE},
+		{"other title", int64(7), "Fog on the Hills", nil, nil,
+			ERROR_NOT_FOUND},
+		{"other singer", int64(8), "Rain on the Road", nil, nil,
+			ERROR_NOT_FOUND},
+		{"aborted", int64(7), "Rain on the Road", aborted, nil, ERROR_ABORTED},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := newFake()
+			if tc.fail != nil {
+				fake.FailOn("FROM Albums", tc.fail)
+			}
+			got, e := getAlbumId(context.Background(), fake, nil,
+				tc.singerId, tc.title)
+			var err error
+			if e != nil {
+				err = e
+			}
+			if class := Classify(err); class != tc.wantClass {
+				t.Fatalf("getAlbumId() error class = %s, want %s", class,
+					tc.wantClass)
+			}
+			if got != tc.want {
+				t.Errorf("getAlbumId() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAddAll(t *testing.T) {
+	strategies := []struct {
+		name string
+		add  func(context.Context, spannerdb.Client,
+			testdata.SingerAlbum) (*AddResult, error)
+	}{
+		{"AddAllNoTxn", AddAllNoTxn},
+		{"AddAllTxn", AddAllTxn},
+	}
+	tests := []struct {
+		name          string
+		firstName     string
+		title         string
+		fail          string
+		singerCreated bool
+		albumCreated  bool
+		singers       int
+		albums        int
+	}{
+		{"new singer", "Major B", "Rain on the Road", "", true, true, 2, 2},
+		{"existing singer", "Captain A", "Fog on the Hills", "", false, true,
+			1, 2},
+		{"existing album", "Captain A", "Rain on the Road", "", false, false,
+			1, 1},
+		{"lookup error", "Captain A", "Rain on the Road", "FROM Singers",
+			false, false, 1, 1},
+		{"insert error", "Captain A", "Fog on the Hills", "INSERT Albums",
+			false, false, 1, 1},
+	}
+	for _, s := range strategies {
+		for _, tc := range tests {
+			t.Run(s.name+"/"+tc.name, func(t *testing.T) {
+				fake := newFake()
+				if tc.fail != "" {
+					fake.FailOn(tc.fail, status.Error(codes.Internal, "fail"))
+				}
+				result, err := s.add(context.Background(), fake,
+					testdata.SingerAlbum{
+						FirstName:  tc.firstName,
+						LastName:   "Zero II",
+						AlbumTitle: tc.title,
+					})
+				if tc.fail != "" {
+					if err == nil {
+						t.Fatalf("%s() succeeded, want error", s.name)
+					}
+				} else if err != nil {
+					t.Fatalf("%s() error = %v", s.name, err)
+				} else {
+					if result.SingerCreated != tc.singerCreated ||
+						result.AlbumCreated != tc.albumCreated {
+						t.Errorf("%s() created singer %t, album %t, want %t, %t",
+							s.name, result.SingerCreated, result.AlbumCreated,
+							tc.singerCreated, tc.albumCreated)
+					}
+					if result.AlbumId == nil {
+						t.Errorf("%s() returned no album id", s.name)
+					}
+				}
+				if n := len(fake.Rows("Singers")); n != tc.singers {
+					t.Errorf("%d singers, want %d", n, tc.singers)
+				}
+				if n := len(fake.Rows("Albums")); n != tc.albums {
+					t.Errorf("%d albums, want %d", n, tc.albums)
+				}
+			})
+		}
+	}
+}
+
+func TestAddAllWritesColumns(t *testing.T) {
+	birthDate := civil.Date{Year: 1985, Month: time.June, Day: 15}
+	fake := spannerdbfake.New()
+	_, err := AddAllTxn(context.Background(), fake, testdata.SingerAlbum{
+		FirstName:       "Major B",
+		LastName:        "Zero II",
+		AlbumTitle:      "Rain on the Road",
+		BirthDate:       birthDate,
+		MarketingBudget: 25000,
+	})
+	if err != nil {
+		t.Fatalf("AddAllTxn() error = %v", err)
+	}
+	singer := fake.Rows("Singers")[0]
+	if singer["BirthDate"] != birthDate {
+		t.Errorf("BirthDate = %v, want %v", singer["BirthDate"], birthDate)
+	}
+	if _, ok := singer["LastUpdated"].(time.Time); !ok {
+		t.Errorf("LastUpdated = %v, want the commit timestamp",
+			singer["LastUpdated"])
+	}
+	album := fake.Rows("Albums")[0]
+	if album["MarketingBudget"] != int64(25000) {
+		t.Errorf("MarketingBudget = %v, want 25000", album["MarketingBudget"])
+	}
+
+	// Unset values are written as NULL
+	_, err = AddAllNoTxn(context.Background(), fake, testdata.SingerAlbum{
+		FirstName:  "Captain A",
+		LastName:   "Zero II",
+		AlbumTitle: "Fog on the Hills",
+	})
+	if err != nil {
+		t.Fatalf("AddAllNoTxn() error = %v", err)
+	}
+	if v := fake.Rows("Singers")[1]["BirthDate"]; v != nil {
+		t.Errorf("BirthDate = %v, want NULL", v)
+	}
+	if v := fake.Rows("Albums")[1]["MarketingBudget"]; v != nil {
+		t.Errorf("MarketingBudget = %v, want NULL", v)
+	}
+}
+
+// A client that runs every read-write transaction twice, as Spanner does when
+// the first attempt is aborted
+type abortingClient struct {
+	*spannerdbfake.Fake
+}
+
+func (c abortingClient) ReadWriteTransaction(ctx context.Context,
+	f func(context.Context, spannerdb.ReadWriteTransaction) error) (time.Time,
+	error) {
+	c.Fake.ReadWriteTransaction(ctx, func(ctx context.Context,
+		txn spannerdb.ReadWriteTransaction) error {
+		if err := f(ctx, txn); err != nil {
+			return err
+		}
+		return status.Error(codes.Aborted, "aborted")
+	})
+	return c.Fake.ReadWriteTransaction(ctx, f)
+}
+
+func TestAddAllTxnRetryReusesKeys(t *testing.T) {
+	data := testdata.SingerAlbum{
+		FirstName:  "Major B",
+		LastName:   "One",
+		AlbumTitle: "Fog on the Hills",
+	}
+	add := func(client spannerdb.Client) *AddResult {
+		random.Seed(42)
+		result, err := AddAllTxn(context.Background(), client, data)
+		if err != nil {
+			t.Fatalf("AddAllTxn() error = %v", err)
+		}
+		return result
+	}
+	want := add(newFake())
+	wantNext := random.Int63()
+	got := add(abortingClient{newFake()})
+	if got.SingerId != want.SingerId || got.AlbumId != want.AlbumId {
+		t.Errorf("Keys after retry = %v, %v, want %v, %v", got.SingerId,
+			got.AlbumId, want.SingerId, want.AlbumId)
+	}
+	if next := random.Int63(); next != wantNext {
+		t.Errorf("Retry advanced the random sequence, next value = %d, "+
+			"want %d", next, wantNext)
+	}
+}